@@ -0,0 +1,31 @@
+// Command backfill-colour-buckets sets the colourBucket attribute on products written before the colour bucket
+// index existed, so searchProducts can find them. It reads AWS_REGION, DYNAMO_ENDPOINT and PRODUCTS_TABLE from
+// the environment.
+//
+//	go run ./handlers/cmd/backfill-colour-buckets -dry-run
+package main
+
+import (
+	"os"
+
+	"github.com/projects/cmyk-api/handlers/cmd/cmdutil"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+)
+
+func main() {
+	dryRun := cmdutil.DryRunFlag("report the products that need a colour bucket without writing them")
+	endpoint := cmdutil.EndpointFlag()
+	ctx, logger := cmdutil.Start()
+
+	repo, err := ddb.NewProductsTableRepo(ctx, os.Getenv("AWS_REGION"), cmdutil.DynamoDBOptions(*endpoint)...)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot connect to the products table")
+	}
+
+	report, err := repo.BackfillColourBuckets(ctx, *dryRun)
+	if err != nil {
+		logger.Fatal().Err(err).Interface("report", report).Msg("backfill failed")
+	}
+
+	cmdutil.WriteReport(report)
+}
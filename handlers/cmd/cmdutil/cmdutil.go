@@ -0,0 +1,49 @@
+// Package cmdutil holds the setup the table maintenance commands share. Each writes a JSON report to stdout, so
+// everything else they print goes to stderr.
+package cmdutil
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"time"
+
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// EndpointFlag registers -endpoint, which defaults to DYNAMO_ENDPOINT.
+func EndpointFlag() *string {
+	return flag.String("endpoint", os.Getenv(ddb.DynamoEndpointEnvKey), "DynamoDB endpoint, such as http://localhost:8000 for DynamoDB Local")
+}
+
+// DryRunFlag registers -dry-run. The usage says what a dry run reports in place of the changes.
+func DryRunFlag(usage string) *bool {
+	return flag.Bool("dry-run", false, usage)
+}
+
+// Start parses the flags and returns a context carrying a logger that writes to stderr, keeping stdout for the
+// report.
+func Start() (context.Context, zerolog.Logger) {
+	flag.Parse()
+	logger := util.NewZeroLog(zerolog.InfoLevel, zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+	return logger.WithContext(context.Background()), logger
+}
+
+// DynamoDBOptions connects to endpoint when it is set, and to AWS otherwise.
+func DynamoDBOptions(endpoint string) []ddb.DynamoDBOption {
+	var options []ddb.DynamoDBOption
+	if len(endpoint) > 0 {
+		options = append(options, ddb.WithEndpoint(endpoint))
+	}
+	return options
+}
+
+// WriteReport writes report to stdout as indented JSON.
+func WriteReport(report any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+}
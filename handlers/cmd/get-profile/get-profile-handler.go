@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	get_profile "github.com/projects/cmyk-api/handlers/lambda/get-profile"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"os"
+)
+
+var usersRepo ddb.UsersRepo
+
+func init() {
+	repo, err := ddb.NewUsersTableRepo(context.TODO(), os.Getenv("AWS_REGION"))
+	if err != nil {
+		panic(err)
+	}
+	usersRepo = *repo
+}
+
+func main() {
+	lambda.Start(get_profile.NewGetProfileHandler(
+		util.NewRealClock(),
+		usersRepo,
+		get_profile.WithLogger(util.NewProdLogger(zerolog.InfoLevel)),
+	))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	proof_product "github.com/projects/cmyk-api/handlers/lambda/proof-product"
+	"github.com/projects/cmyk-api/handlers/render"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"os"
+)
+
+var productsRepo ddb.ProductsRepo
+var template *render.Template
+
+func init() {
+	repo, err := ddb.NewProductsTableRepo(context.TODO(), os.Getenv("AWS_REGION"))
+	if err != nil {
+		panic(err)
+	}
+	productsRepo = *repo
+
+	template, err = render.Bottle()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	lambda.Start(proof_product.NewProofProductHandler(
+		util.NewRealClock(),
+		productsRepo,
+		proof_product.WithLogger(util.NewProdLogger(zerolog.InfoLevel)),
+		proof_product.WithTemplate(template),
+	))
+}
@@ -0,0 +1,67 @@
+// Command provision-tables creates or updates the DynamoDB tables declared in handlers/db/tables so they match their
+// schemas, or deletes them. It is safe to run repeatedly. Indexes the schemas do not declare are reported and only
+// deleted with -prune, and tables in AWS are only deleted with -yes. It reads AWS_REGION, DYNAMO_ENDPOINT,
+// USERS_TABLE and PRODUCTS_TABLE from the environment.
+//
+//	go run ./handlers/cmd/provision-tables -endpoint http://localhost:8000
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/projects/cmyk-api/handlers/cmd/cmdutil"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/db/tables"
+	"github.com/projects/cmyk-api/handlers/util"
+)
+
+var schemas = map[string]tables.Schema{
+	"users":    tables.Users,
+	"products": tables.Products,
+}
+
+func main() {
+	endpoint := cmdutil.EndpointFlag()
+	remove := flag.Bool("delete", false, "delete the tables instead of provisioning them")
+	confirmed := flag.Bool("yes", false, "confirm -delete when no -endpoint is given, deleting the tables in AWS")
+	prune := flag.Bool("prune", false, "delete indexes the schemas do not declare instead of only reporting them")
+	names := flag.String("tables", "users,products", "comma separated tables to provision")
+	ctx, logger := cmdutil.Start()
+
+	if *remove && len(*endpoint) == 0 && !*confirmed {
+		logger.Fatal().Msg("refusing to delete tables in AWS, pass -endpoint to delete local tables or -yes to confirm")
+	}
+
+	client, err := ddb.NewDynamoDB(ctx, os.Getenv("AWS_REGION"), cmdutil.DynamoDBOptions(*endpoint)...)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot connect to DynamoDB")
+	}
+	var options []tables.ProvisionerOption
+	if *prune {
+		options = append(options, tables.WithPrune())
+	}
+	provisioner := tables.NewProvisioner(client, util.NewRealClock(), options...)
+
+	changes := []tables.Change{}
+	for _, name := range strings.Split(*names, ",") {
+		schema, ok := schemas[strings.TrimSpace(name)]
+		if !ok {
+			logger.Fatal().Str("table", name).Msg("unknown table, expected users or products")
+		}
+
+		var made []tables.Change
+		if *remove {
+			made, err = provisioner.Delete(ctx, schema.TableName())
+		} else {
+			made, err = provisioner.Ensure(ctx, schema, schema.TableName())
+		}
+		changes = append(changes, made...)
+		if err != nil {
+			logger.Fatal().Err(err).Interface("changes", changes).Msg("provisioning failed")
+		}
+	}
+
+	cmdutil.WriteReport(changes)
+}
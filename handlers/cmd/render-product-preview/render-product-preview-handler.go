@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	render_product_preview "github.com/projects/cmyk-api/handlers/lambda/render-product-preview"
+	"github.com/projects/cmyk-api/handlers/render"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"os"
+)
+
+var productsRepo ddb.ProductsRepo
+var template *render.Template
+
+func init() {
+	repo, err := ddb.NewProductsTableRepo(context.TODO(), os.Getenv("AWS_REGION"))
+	if err != nil {
+		panic(err)
+	}
+	productsRepo = *repo
+
+	template, err = render.Bottle()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	lambda.Start(render_product_preview.NewRenderProductPreviewHandler(
+		util.NewRealClock(),
+		productsRepo,
+		render_product_preview.WithLogger(util.NewProdLogger(zerolog.InfoLevel)),
+		render_product_preview.WithTemplate(template),
+	))
+}
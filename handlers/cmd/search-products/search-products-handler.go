@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	search_products "github.com/projects/cmyk-api/handlers/lambda/search-products"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"os"
+)
+
+var productsRepo ddb.ProductsRepo
+var pageTokens ddb.PageTokenCodec
+
+func init() {
+	repo, err := ddb.NewProductsTableRepo(context.TODO(), os.Getenv("AWS_REGION"))
+	if err != nil {
+		panic(err)
+	}
+	productsRepo = *repo
+
+	pageTokens, err = ddb.NewPageTokenCodec([]byte(os.Getenv(ddb.PageTokenSecretEnvKey)))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	handler, err := search_products.NewSearchProductsHandler(
+		util.NewRealClock(),
+		productsRepo,
+		pageTokens,
+		search_products.WithLogger(util.NewProdLogger(zerolog.InfoLevel)),
+	)
+	if err != nil {
+		panic(err)
+	}
+	lambda.Start(handler)
+}
@@ -0,0 +1,49 @@
+// Command test-data-janitor deletes test data that DynamoDB has not expired yet, which is all of it on DynamoDB
+// Local, and email uniqueness items left behind by deleted users. It reads AWS_REGION, DYNAMO_ENDPOINT,
+// USERS_TABLE and PRODUCTS_TABLE from the environment.
+//
+//	go run ./handlers/cmd/test-data-janitor -dry-run
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/projects/cmyk-api/handlers/cmd/cmdutil"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/util"
+)
+
+var tableEnvKeys = map[string]string{
+	"users":    ddb.UsersTableEnvKey,
+	"products": ddb.ProductsTableEnvKey,
+}
+
+func main() {
+	dryRun := cmdutil.DryRunFlag("report the items that would be deleted without deleting them")
+	endpoint := cmdutil.EndpointFlag()
+	tables := flag.String("tables", "users,products", "comma separated tables to sweep")
+	ctx, logger := cmdutil.Start()
+	options := cmdutil.DynamoDBOptions(*endpoint)
+
+	reports := []ddb.SweepReport{}
+	for _, table := range strings.Split(*tables, ",") {
+		envKey, ok := tableEnvKeys[strings.TrimSpace(table)]
+		if !ok {
+			logger.Fatal().Str("table", table).Msg("unknown table, expected users or products")
+		}
+		instance, err := ddb.NewInstance(ctx, os.Getenv("AWS_REGION"), envKey, options...)
+		if err != nil {
+			logger.Fatal().Err(err).Str("table", table).Msg("cannot connect to the table")
+		}
+
+		report, err := ddb.NewJanitor(instance, util.NewRealClock()).Sweep(ctx, *dryRun)
+		reports = append(reports, report)
+		if err != nil {
+			logger.Fatal().Err(err).Interface("reports", reports).Msg("sweep failed")
+		}
+	}
+
+	cmdutil.WriteReport(reports)
+}
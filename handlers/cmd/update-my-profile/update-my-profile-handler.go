@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	update_my_profile "github.com/projects/cmyk-api/handlers/lambda/update-my-profile"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"os"
+)
+
+var usersRepo ddb.UsersRepo
+
+func init() {
+	repo, err := ddb.NewUsersTableRepo(context.TODO(), os.Getenv("AWS_REGION"))
+	if err != nil {
+		panic(err)
+	}
+	usersRepo = *repo
+}
+
+func main() {
+	lambda.Start(update_my_profile.NewUpdateMyProfileHandler(
+		util.NewRealClock(),
+		usersRepo,
+		update_my_profile.WithLogger(util.NewProdLogger(zerolog.InfoLevel)),
+	))
+}
@@ -0,0 +1,79 @@
+package colour
+
+import (
+	"fmt"
+	"math"
+)
+
+// BucketSize is the edge length, in Lab units, of the cubes colours are quantised into for indexing. Buckets only
+// narrow a search down: two colours in the same bucket can be up to 20√3, about 35 ΔE76, apart and two in adjacent
+// buckets up to 40√3, about 69 ΔE76, so matches still have to be ranked by their colour difference.
+const BucketSize = 20.0
+
+// Bucket is a cube of Lab space. Its String form is stored on each product so the catalogue can be queried by
+// colour through a secondary index instead of scanned.
+type Bucket struct {
+	L, A, B int
+}
+
+// bounds of the bucket coordinates that can hold an sRGB colour: L is in [0, 100], a in about [-87, 99] and b in
+// about [-108, 95].
+var (
+	minBucket = Bucket{L: 0, A: -4, B: -5}
+	maxBucket = Bucket{L: 5, A: 5, B: 5}
+)
+
+// BucketOf finds the bucket holding c. Buckets are centred on multiples of BucketSize so that greys, with a and b
+// near zero, sit in the middle of a bucket rather than on the boundary between four.
+func BucketOf(c Lab) Bucket {
+	quantise := func(v float64) int { return int(math.Floor(v/BucketSize + 0.5)) }
+	return Bucket{L: quantise(c.L), A: quantise(c.A), B: quantise(c.B)}
+}
+
+func (b Bucket) String() string {
+	return fmt.Sprintf("L%d:A%d:B%d", b.L, b.A, b.B)
+}
+
+// Ring returns the buckets whose largest coordinate difference from b is exactly distance, leaving out buckets no
+// sRGB colour can fall in. Ring(0) is b itself and the rings 0..n together cover every bucket within n of b.
+func (b Bucket) Ring(distance int) []Bucket {
+	var ring []Bucket
+	for l := b.L - distance; l <= b.L+distance; l++ {
+		for a := b.A - distance; a <= b.A+distance; a++ {
+			for bb := b.B - distance; bb <= b.B+distance; bb++ {
+				if abs(l-b.L) != distance && abs(a-b.A) != distance && abs(bb-b.B) != distance {
+					continue
+				}
+				candidate := Bucket{L: l, A: a, B: bb}
+				if candidate.inRange() {
+					ring = append(ring, candidate)
+				}
+			}
+		}
+	}
+	return ring
+}
+
+// MaxRing is the ring distance beyond which no bucket around b holds an sRGB colour.
+func (b Bucket) MaxRing() int {
+	distance := 0
+	for _, d := range []int{b.L - minBucket.L, maxBucket.L - b.L, b.A - minBucket.A, maxBucket.A - b.A, b.B - minBucket.B, maxBucket.B - b.B} {
+		if d > distance {
+			distance = d
+		}
+	}
+	return distance
+}
+
+func (b Bucket) inRange() bool {
+	return b.L >= minBucket.L && b.L <= maxBucket.L &&
+		b.A >= minBucket.A && b.A <= maxBucket.A &&
+		b.B >= minBucket.B && b.B <= maxBucket.B
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,55 @@
+package colour
+
+import (
+	"fmt"
+	"math"
+)
+
+// CMYK is a naive device CMYK colour with each ink between 0 and 1. It is derived directly from sRGB without an
+// ICC profile, so it describes ink proportions rather than a calibrated print colour.
+type CMYK struct {
+	C, M, Y, K float64
+}
+
+// ParseCMYK reads cmyk(67%, 33%, 0%, 40%).
+func ParseCMYK(s string) (CMYK, error) {
+	args, err := functionArgs(s, "cmyk", 4)
+	if err != nil {
+		return CMYK{}, err
+	}
+
+	var inks [4]float64
+	for i, arg := range args {
+		v, err := parsePercent(arg)
+		if err != nil || v < 0 || v > 1 {
+			return CMYK{}, fmt.Errorf("invalid cmyk colour [%s]", s)
+		}
+		inks[i] = v
+	}
+	return CMYK{C: inks[0], M: inks[1], Y: inks[2], K: inks[3]}, nil
+}
+
+func (c RGB) CMYK() CMYK {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	k := 1 - math.Max(r, math.Max(g, b))
+	if k == 1 {
+		return CMYK{K: 1}
+	}
+	return CMYK{
+		C: (1 - r - k) / (1 - k),
+		M: (1 - g - k) / (1 - k),
+		Y: (1 - b - k) / (1 - k),
+		K: k,
+	}
+}
+
+func (c CMYK) RGB() RGB {
+	channel := func(ink float64) uint8 {
+		return uint8(math.Round(255 * (1 - ink) * (1 - c.K)))
+	}
+	return RGB{R: channel(c.C), G: channel(c.M), B: channel(c.Y)}
+}
+
+func (c CMYK) String() string {
+	return fmt.Sprintf("cmyk(%s, %s, %s, %s)", formatPercent(c.C), formatPercent(c.M), formatPercent(c.Y), formatPercent(c.K))
+}
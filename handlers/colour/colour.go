@@ -0,0 +1,232 @@
+// Package colour converts between the colour notations the API accepts (hex, rgb(), hsl() and cmyk()) and the
+// CIE spaces used to compare colours the way people perceive them.
+package colour
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RGB is an 8 bit per channel sRGB colour, as product colours are stored.
+type RGB struct {
+	R, G, B uint8
+}
+
+// Parse reads any of the supported notations: #RRGGBB, #RGB, rgb(), hsl() or cmyk().
+func Parse(s string) (RGB, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case strings.HasPrefix(value, "rgb("):
+		return ParseRGB(value)
+	case strings.HasPrefix(value, "hsl("):
+		hsl, err := ParseHSL(value)
+		return hsl.RGB(), err
+	case strings.HasPrefix(value, "cmyk("):
+		cmyk, err := ParseCMYK(value)
+		return cmyk.RGB(), err
+	}
+	return ParseHex(value)
+}
+
+// ParseHex reads #RRGGBB or #RGB, with or without the leading #.
+func ParseHex(s string) (RGB, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return RGB{}, fmt.Errorf("invalid hex colour [%s]", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return RGB{}, fmt.Errorf("invalid hex colour [%s]", s)
+	}
+	return RGB{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+// ParseRGB reads rgb(51, 102, 153) or rgb(20%, 40%, 60%).
+func ParseRGB(s string) (RGB, error) {
+	args, err := functionArgs(s, "rgb", 3)
+	if err != nil {
+		return RGB{}, err
+	}
+
+	var channels [3]uint8
+	for i, arg := range args {
+		var v float64
+		if strings.HasSuffix(arg, "%") {
+			v, err = parsePercent(arg)
+			v *= 255
+		} else {
+			v, err = parseNumber(arg)
+		}
+		if err != nil || v < 0 || v > 255 {
+			return RGB{}, fmt.Errorf("invalid rgb colour [%s]", s)
+		}
+		channels[i] = uint8(math.Round(v))
+	}
+	return RGB{R: channels[0], G: channels[1], B: channels[2]}, nil
+}
+
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// CSS formats the colour as rgb(51, 102, 153).
+func (c RGB) CSS() string {
+	return fmt.Sprintf("rgb(%d, %d, %d)", c.R, c.G, c.B)
+}
+
+// XYZ is a CIE 1931 colour relative to the D65 white point, with Y of white at 100.
+type XYZ struct {
+	X, Y, Z float64
+}
+
+// D65 is the reference white of sRGB.
+var D65 = XYZ{X: 95.047, Y: 100.0, Z: 108.883}
+
+func linearise(channel uint8) float64 {
+	v := float64(channel) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// gammaEncode is the inverse of linearise, clamping colours outside the sRGB gamut to its surface.
+func gammaEncode(v float64) uint8 {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+func (c RGB) XYZ() XYZ {
+	r, g, b := linearise(c.R), linearise(c.G), linearise(c.B)
+	return XYZ{
+		X: (0.4124564*r + 0.3575761*g + 0.1804375*b) * 100,
+		Y: (0.2126729*r + 0.7151522*g + 0.0721750*b) * 100,
+		Z: (0.0193339*r + 0.1191920*g + 0.9503041*b) * 100,
+	}
+}
+
+// InGamut reports whether the colour can be shown in sRGB without clipping.
+func (c XYZ) InGamut() bool {
+	r, g, b := c.linearRGB()
+	const tolerance = 1e-6
+	return r >= -tolerance && r <= 1+tolerance && g >= -tolerance && g <= 1+tolerance && b >= -tolerance && b <= 1+tolerance
+}
+
+func (c XYZ) linearRGB() (float64, float64, float64) {
+	x, y, z := c.X/100, c.Y/100, c.Z/100
+	return 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z
+}
+
+// RGB converts back to sRGB, clipping out of gamut colours.
+func (c XYZ) RGB() RGB {
+	r, g, b := c.linearRGB()
+	return RGB{R: gammaEncode(r), G: gammaEncode(g), B: gammaEncode(b)}
+}
+
+// Lab is a CIELAB colour under D65, where equal distances are roughly equal perceived differences.
+type Lab struct {
+	L, A, B float64
+}
+
+const (
+	labEpsilon = 216.0 / 24389.0
+	labKappa   = 24389.0 / 27.0
+)
+
+func (c XYZ) Lab() Lab {
+	f := func(t float64) float64 {
+		if t > labEpsilon {
+			return math.Cbrt(t)
+		}
+		return (labKappa*t + 16) / 116
+	}
+	fx, fy, fz := f(c.X/D65.X), f(c.Y/D65.Y), f(c.Z/D65.Z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+func (c Lab) XYZ() XYZ {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	inverse := func(f float64) float64 {
+		if cube := f * f * f; cube > labEpsilon {
+			return cube
+		}
+		return (116*f - 16) / labKappa
+	}
+	y := c.L / labKappa
+	if c.L > labKappa*labEpsilon {
+		y = fy * fy * fy
+	}
+	return XYZ{X: inverse(fx) * D65.X, Y: y * D65.Y, Z: inverse(fz) * D65.Z}
+}
+
+func (c RGB) Lab() Lab {
+	return c.XYZ().Lab()
+}
+
+// RGB converts back to sRGB, clipping out of gamut colours.
+func (c Lab) RGB() RGB {
+	return c.XYZ().RGB()
+}
+
+func (c Lab) String() string {
+	return fmt.Sprintf("lab(%.2f, %.2f, %.2f)", c.L, c.A, c.B)
+}
+
+// functionArgs splits a CSS style function such as rgb(1, 2, 3) into its arguments.
+func functionArgs(s string, name string, count int) ([]string, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	if !strings.HasPrefix(value, name+"(") || !strings.HasSuffix(value, ")") {
+		return nil, fmt.Errorf("invalid %s colour [%s]", name, s)
+	}
+	args := strings.Split(value[len(name)+1:len(value)-1], ",")
+	if len(args) != count {
+		return nil, fmt.Errorf("invalid %s colour [%s]", name, s)
+	}
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	return args, nil
+}
+
+// parsePercent reads 40% as 0.4.
+func parsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("expected a percentage but was [%s]", s)
+	}
+	v, err := parseNumber(strings.TrimSuffix(s, "%"))
+	if err != nil {
+		return 0, err
+	}
+	return v / 100, nil
+}
+
+// parseNumber reads a finite number. strconv.ParseFloat also accepts NaN and Inf, and NaN passes every range check.
+func parseNumber(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("expected a finite number but was [%s]", s)
+	}
+	return v, nil
+}
+
+// formatPercent writes 0.4 as 40%, keeping at most one decimal place.
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/10, 'f', -1, 64) + "%"
+}
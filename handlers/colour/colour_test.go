@@ -0,0 +1,232 @@
+package colour
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want RGB
+	}{
+		{"#336699", RGB{51, 102, 153}},
+		{"336699", RGB{51, 102, 153}},
+		{"#369", RGB{51, 102, 153}},
+		{"rgb(51, 102, 153)", RGB{51, 102, 153}},
+		{"RGB(20%, 40%, 60%)", RGB{51, 102, 153}},
+		{"hsl(210, 50%, 40%)", RGB{51, 102, 153}},
+		{"hsl(210deg, 50%, 40%)", RGB{51, 102, 153}},
+		{"cmyk(66.7%, 33.3%, 0%, 40%)", RGB{51, 102, 153}},
+		{"cmyk(0%, 0%, 0%, 100%)", RGB{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, bad := range []string{"", "#12345", "#GGGGGG", "#1234567", "rgb(256, 0, 0)", "rgb(1, 2)", "hsl(10, 50, 50%)", "cmyk(0%, 0%, 0%, 101%)", "cmyk(0%, 0%, 0%)",
+		"rgb(NaN, 0, 0)", "rgb(0, Inf, 0)", "rgb(0, 0, nan%)", "hsl(NaN, 50%, 50%)", "hsl(+Inf, 50%, 50%)", "hsl(0, NaN%, 50%)", "cmyk(0%, 0%, 0%, NaN%)"} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	c := RGB{51, 102, 153}
+	assert.Equal(t, "#336699", c.Hex())
+	assert.Equal(t, "rgb(51, 102, 153)", c.CSS())
+	assert.Equal(t, "hsl(210, 50%, 40%)", c.HSL().String())
+	assert.Equal(t, "cmyk(66.7%, 33.3%, 0%, 40%)", c.CMYK().String())
+}
+
+func TestRGBToHSL(t *testing.T) {
+	tests := []struct {
+		rgb  RGB
+		want HSL
+	}{
+		{RGB{0, 0, 0}, HSL{0, 0, 0}},
+		{RGB{255, 255, 255}, HSL{0, 0, 1}},
+		{RGB{255, 0, 0}, HSL{0, 1, 0.5}},
+		{RGB{0, 255, 0}, HSL{120, 1, 0.5}},
+		{RGB{0, 0, 255}, HSL{240, 1, 0.5}},
+		{RGB{255, 0, 255}, HSL{300, 1, 0.5}},
+		{RGB{128, 128, 128}, HSL{0, 0, 0.50196}},
+		{RGB{51, 102, 153}, HSL{210, 0.5, 0.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rgb.Hex(), func(t *testing.T) {
+			got := tt.rgb.HSL()
+			assert.InDelta(t, tt.want.H, got.H, 0.01)
+			assert.InDelta(t, tt.want.S, got.S, 0.001)
+			assert.InDelta(t, tt.want.L, got.L, 0.001)
+			assert.Equal(t, tt.rgb, got.RGB(), "round trip")
+		})
+	}
+}
+
+func TestRGBToCMYK(t *testing.T) {
+	tests := []struct {
+		rgb  RGB
+		want CMYK
+	}{
+		{RGB{0, 0, 0}, CMYK{0, 0, 0, 1}},
+		{RGB{255, 255, 255}, CMYK{0, 0, 0, 0}},
+		{RGB{0, 255, 255}, CMYK{1, 0, 0, 0}},
+		{RGB{255, 0, 255}, CMYK{0, 1, 0, 0}},
+		{RGB{255, 255, 0}, CMYK{0, 0, 1, 0}},
+		{RGB{51, 102, 153}, CMYK{0.6667, 0.3333, 0, 0.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rgb.Hex(), func(t *testing.T) {
+			got := tt.rgb.CMYK()
+			assert.InDelta(t, tt.want.C, got.C, 0.0001)
+			assert.InDelta(t, tt.want.M, got.M, 0.0001)
+			assert.InDelta(t, tt.want.Y, got.Y, 0.0001)
+			assert.InDelta(t, tt.want.K, got.K, 0.0001)
+			assert.Equal(t, tt.rgb, got.RGB(), "round trip")
+		})
+	}
+}
+
+func TestRGBToLab(t *testing.T) {
+	// sRGB under D65 as published by Bruce Lindbloom's colour calculator
+	tests := []struct {
+		rgb  RGB
+		xyz  XYZ
+		want Lab
+	}{
+		{RGB{255, 255, 255}, XYZ{95.047, 100, 108.883}, Lab{100, 0, 0}},
+		{RGB{0, 0, 0}, XYZ{0, 0, 0}, Lab{0, 0, 0}},
+		{RGB{255, 0, 0}, XYZ{41.2456, 21.2673, 1.9334}, Lab{53.2408, 80.0925, 67.2032}},
+		{RGB{0, 255, 0}, XYZ{35.7576, 71.5152, 11.9192}, Lab{87.7347, -86.1827, 83.1793}},
+		{RGB{0, 0, 255}, XYZ{18.0437, 7.2175, 95.0304}, Lab{32.2970, 79.1875, -107.8602}},
+		{RGB{128, 128, 128}, XYZ{20.5175, 21.5861, 23.5072}, Lab{53.5850, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rgb.Hex(), func(t *testing.T) {
+			xyz := tt.rgb.XYZ()
+			assert.InDelta(t, tt.xyz.X, xyz.X, 0.01)
+			assert.InDelta(t, tt.xyz.Y, xyz.Y, 0.01)
+			assert.InDelta(t, tt.xyz.Z, xyz.Z, 0.01)
+
+			lab := tt.rgb.Lab()
+			assert.InDelta(t, tt.want.L, lab.L, 0.01)
+			assert.InDelta(t, tt.want.A, lab.A, 0.01)
+			assert.InDelta(t, tt.want.B, lab.B, 0.01)
+
+			assert.Equal(t, tt.rgb, lab.RGB(), "round trip")
+		})
+	}
+}
+
+func TestLabOutsideSRGBIsClipped(t *testing.T) {
+	saturatedCyan := Lab{L: 60, A: -80, B: -60}
+	assert.False(t, saturatedCyan.XYZ().InGamut())
+	assert.True(t, RGB{0, 128, 255}.XYZ().InGamut())
+
+	clipped := saturatedCyan.RGB()
+	assert.Equal(t, uint8(0), clipped.R)
+}
+
+func TestDeltaE76(t *testing.T) {
+	assert.InDelta(t, 5, DeltaE76(Lab{50, 0, 0}, Lab{50, 3, 4}), 1e-9)
+	assert.InDelta(t, 13, DeltaE76(Lab{50, 0, 0}, Lab{62, 3, 4}), 1e-9)
+	assert.Zero(t, DeltaE76(Lab{50, 10, 10}, Lab{50, 10, 10}))
+}
+
+func TestDeltaE94(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y Lab
+		want float64
+	}{
+		{"lightness is unweighted", Lab{50, 30, 40}, Lab{60, 30, 40}, 10},
+		{"chroma is weighted by the reference chroma", Lab{50, 30, 40}, Lab{50, 36, 48}, 10 / 3.25},
+		{"neutral reference", Lab{50, 0, 0}, Lab{50, 3, 4}, 5},
+		{"hue is weighted by the reference chroma", Lab{50, 50, 0}, Lab{50, 0, 50}, 50 * 1.4142135623730951 / 1.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, DeltaE94(tt.x, tt.y), 1e-9)
+		})
+	}
+}
+
+func TestDeltaE2000(t *testing.T) {
+	// the 34 test pairs from Sharma, Wu and Dalal, "The CIEDE2000 Color-Difference Formula: Implementation Notes,
+	// Supplementary Test Data, and Mathematical Observations", Color Research and Application, 2005
+	tests := []struct {
+		x, y Lab
+		want float64
+	}{
+		{Lab{50.0000, 2.6772, -79.7751}, Lab{50.0000, 0.0000, -82.7485}, 2.0425},
+		{Lab{50.0000, 3.1571, -77.2803}, Lab{50.0000, 0.0000, -82.7485}, 2.8615},
+		{Lab{50.0000, 2.8361, -74.0200}, Lab{50.0000, 0.0000, -82.7485}, 3.4412},
+		{Lab{50.0000, -1.3802, -84.2814}, Lab{50.0000, 0.0000, -82.7485}, 1.0000},
+		{Lab{50.0000, -1.1848, -84.8006}, Lab{50.0000, 0.0000, -82.7485}, 1.0000},
+		{Lab{50.0000, -0.9009, -85.5211}, Lab{50.0000, 0.0000, -82.7485}, 1.0000},
+		{Lab{50.0000, 0.0000, 0.0000}, Lab{50.0000, -1.0000, 2.0000}, 2.3669},
+		{Lab{50.0000, -1.0000, 2.0000}, Lab{50.0000, 0.0000, 0.0000}, 2.3669},
+		{Lab{50.0000, 2.4900, -0.0010}, Lab{50.0000, -2.4900, 0.0009}, 7.1792},
+		{Lab{50.0000, 2.4900, -0.0010}, Lab{50.0000, -2.4900, 0.0010}, 7.1792},
+		{Lab{50.0000, 2.4900, -0.0010}, Lab{50.0000, -2.4900, 0.0011}, 7.2195},
+		{Lab{50.0000, 2.4900, -0.0010}, Lab{50.0000, -2.4900, 0.0012}, 7.2195},
+		{Lab{50.0000, -0.0010, 2.4900}, Lab{50.0000, 0.0009, -2.4900}, 4.8045},
+		{Lab{50.0000, -0.0010, 2.4900}, Lab{50.0000, 0.0010, -2.4900}, 4.8045},
+		{Lab{50.0000, -0.0010, 2.4900}, Lab{50.0000, 0.0011, -2.4900}, 4.7461},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{50.0000, 0.0000, -2.5000}, 4.3065},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{73.0000, 25.0000, -18.0000}, 27.1492},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{61.0000, -5.0000, 29.0000}, 22.8977},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{56.0000, -27.0000, -3.0000}, 31.9030},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{58.0000, 24.0000, 15.0000}, 19.4535},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{50.0000, 3.1736, 0.5854}, 1.0000},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{50.0000, 3.2972, 0.0000}, 1.0000},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{50.0000, 1.8634, 0.5757}, 1.0000},
+		{Lab{50.0000, 2.5000, 0.0000}, Lab{50.0000, 3.2592, 0.3350}, 1.0000},
+		{Lab{60.2574, -34.0099, 36.2677}, Lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{Lab{63.0109, -31.0961, -5.8663}, Lab{62.8187, -29.7946, -4.0864}, 1.2630},
+		{Lab{61.2901, 3.7196, -5.3901}, Lab{61.4292, 2.2480, -4.9620}, 1.8731},
+		{Lab{35.0831, -44.1164, 3.7933}, Lab{35.0232, -40.0716, 1.5901}, 1.8645},
+		{Lab{22.7233, 20.0904, -46.6940}, Lab{23.0331, 14.9730, -42.5619}, 2.0373},
+		{Lab{36.4612, 47.8580, 18.3852}, Lab{36.2715, 50.5065, 21.2231}, 1.4146},
+		{Lab{90.8027, -2.0831, 1.4410}, Lab{91.1528, -1.6435, 0.0447}, 1.4441},
+		{Lab{90.9257, -0.5406, -0.9208}, Lab{88.6381, -0.8985, -0.7239}, 1.5381},
+		{Lab{6.7747, -0.2908, -2.4247}, Lab{5.8714, -0.0985, -2.2286}, 0.6377},
+		{Lab{2.0776, 0.0795, -1.1350}, Lab{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for i, tt := range tests {
+		assert.InDelta(t, tt.want, DeltaE2000(tt.x, tt.y), 0.00005, "pair %d", i+1)
+		assert.InDelta(t, tt.want, DeltaE2000(tt.y, tt.x), 0.00005, "pair %d is symmetric", i+1)
+	}
+}
+
+func TestBucketOf(t *testing.T) {
+	assert.Equal(t, Bucket{L: 3, A: 4, B: 3}, BucketOf(RGB{R: 255}.Lab()))
+	assert.Equal(t, Bucket{L: 5, A: 0, B: 0}, BucketOf(RGB{255, 255, 255}.Lab()))
+	assert.Equal(t, Bucket{L: 0, A: 0, B: 0}, BucketOf(RGB{0, 0, 0}.Lab()))
+	assert.Equal(t, "L2:A4:B3", Bucket{L: 2, A: 4, B: 3}.String())
+	assert.Equal(t, "L0:A-1:B0", Bucket{L: 0, A: -1, B: 0}.String())
+}
+
+func TestBucketRing(t *testing.T) {
+	b := Bucket{L: 2, A: 0, B: 0}
+	assert.Equal(t, []Bucket{b}, b.Ring(0))
+	assert.Len(t, b.Ring(1), 26)
+	assert.Len(t, b.Ring(2), 5*5*5-3*3*3, "the L range stops at 0 and 5")
+
+	seen := map[Bucket]bool{}
+	for ring := 0; ring <= b.MaxRing(); ring++ {
+		for _, n := range b.Ring(ring) {
+			assert.False(t, seen[n], "%s is in more than one ring", n)
+			seen[n] = true
+		}
+	}
+	assert.True(t, seen[BucketOf(RGB{0, 0, 255}.Lab())], "every sRGB colour should be in some ring")
+	assert.True(t, seen[BucketOf(RGB{0, 255, 0}.Lab())], "every sRGB colour should be in some ring")
+}
@@ -0,0 +1,111 @@
+package colour
+
+import "math"
+
+// DeltaE76 is the CIE76 colour difference, the straight line distance between two colours in Lab.
+func DeltaE76(x, y Lab) float64 {
+	return math.Sqrt(math.Pow(y.L-x.L, 2) + math.Pow(y.A-x.A, 2) + math.Pow(y.B-x.B, 2))
+}
+
+// DeltaE94 is the CIE94 colour difference with the graphic arts weightings. It is not symmetric: the chroma and hue
+// weightings are taken from the reference colour x.
+func DeltaE94(x, y Lab) float64 {
+	const kL, k1, k2 = 1.0, 0.045, 0.015
+
+	c1 := math.Hypot(x.A, x.B)
+	c2 := math.Hypot(y.A, y.B)
+	deltaL := x.L - y.L
+	deltaC := c1 - c2
+	deltaA := x.A - y.A
+	deltaB := x.B - y.B
+	// rounding can make the squared hue difference slightly negative for colours of the same hue
+	deltaH2 := math.Max(0, deltaA*deltaA+deltaB*deltaB-deltaC*deltaC)
+
+	sc := 1 + k1*c1
+	sh := 1 + k2*c1
+	l := deltaL / kL
+	c := deltaC / sc
+	return math.Sqrt(l*l + c*c + deltaH2/(sh*sh))
+}
+
+// DeltaE2000 is the CIEDE2000 colour difference between two colours. A difference below about 1 is not
+// perceptible and below about 2.3 is a just noticeable difference.
+func DeltaE2000(x, y Lab) float64 {
+	const kL, kC, kH = 1.0, 1.0, 1.0
+
+	c1 := math.Hypot(x.A, x.B)
+	c2 := math.Hypot(y.A, y.B)
+	meanC := (c1 + c2) / 2
+	g := 0.5 * (1 - math.Sqrt(math.Pow(meanC, 7)/(math.Pow(meanC, 7)+math.Pow(25, 7))))
+
+	a1 := (1 + g) * x.A
+	a2 := (1 + g) * y.A
+	c1p := math.Hypot(a1, x.B)
+	c2p := math.Hypot(a2, y.B)
+	h1p := hueAngle(x.B, a1)
+	h2p := hueAngle(y.B, a2)
+
+	deltaL := y.L - x.L
+	deltaC := c2p - c1p
+
+	var deltah float64
+	switch {
+	case c1p*c2p == 0:
+		deltah = 0
+	case math.Abs(h2p-h1p) <= 180:
+		deltah = h2p - h1p
+	case h2p-h1p > 180:
+		deltah = h2p - h1p - 360
+	default:
+		deltah = h2p - h1p + 360
+	}
+	deltaH := 2 * math.Sqrt(c1p*c2p) * math.Sin(radians(deltah/2))
+
+	meanL := (x.L + y.L) / 2
+	meanCp := (c1p + c2p) / 2
+
+	var meanH float64
+	switch {
+	case c1p*c2p == 0:
+		meanH = h1p + h2p
+	case math.Abs(h1p-h2p) <= 180:
+		meanH = (h1p + h2p) / 2
+	case h1p+h2p < 360:
+		meanH = (h1p + h2p + 360) / 2
+	default:
+		meanH = (h1p + h2p - 360) / 2
+	}
+
+	t := 1 - 0.17*math.Cos(radians(meanH-30)) +
+		0.24*math.Cos(radians(2*meanH)) +
+		0.32*math.Cos(radians(3*meanH+6)) -
+		0.20*math.Cos(radians(4*meanH-63))
+
+	deltaTheta := 30 * math.Exp(-math.Pow((meanH-275)/25, 2))
+	rc := 2 * math.Sqrt(math.Pow(meanCp, 7)/(math.Pow(meanCp, 7)+math.Pow(25, 7)))
+	sl := 1 + (0.015*math.Pow(meanL-50, 2))/math.Sqrt(20+math.Pow(meanL-50, 2))
+	sc := 1 + 0.045*meanCp
+	sh := 1 + 0.015*meanCp*t
+	rt := -math.Sin(radians(2*deltaTheta)) * rc
+
+	l := deltaL / (kL * sl)
+	c := deltaC / (kC * sc)
+	h := deltaH / (kH * sh)
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
+
+// hueAngle is atan2(b, a) in degrees in [0, 360).
+func hueAngle(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
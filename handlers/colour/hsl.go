@@ -0,0 +1,97 @@
+package colour
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HSL is hue in degrees [0, 360) with saturation and lightness between 0 and 1.
+type HSL struct {
+	H, S, L float64
+}
+
+// ParseHSL reads hsl(210, 50%, 40%). The hue may carry a deg suffix.
+func ParseHSL(s string) (HSL, error) {
+	args, err := functionArgs(s, "hsl", 3)
+	if err != nil {
+		return HSL{}, err
+	}
+
+	h, err := parseNumber(strings.TrimSuffix(args[0], "deg"))
+	if err != nil {
+		return HSL{}, fmt.Errorf("invalid hsl colour [%s]", s)
+	}
+	saturation, err := parsePercent(args[1])
+	if err != nil || saturation < 0 || saturation > 1 {
+		return HSL{}, fmt.Errorf("invalid hsl colour [%s]", s)
+	}
+	lightness, err := parsePercent(args[2])
+	if err != nil || lightness < 0 || lightness > 1 {
+		return HSL{}, fmt.Errorf("invalid hsl colour [%s]", s)
+	}
+
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	return HSL{H: h, S: saturation, L: lightness}, nil
+}
+
+func (c RGB) HSL() HSL {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l := (max + min) / 2
+	if max == min {
+		return HSL{L: l}
+	}
+
+	d := max - min
+	s := d / (1 - math.Abs(2*l-1))
+
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return HSL{H: h, S: s, L: l}
+}
+
+func (c HSL) RGB() RGB {
+	chroma := (1 - math.Abs(2*c.L-1)) * c.S
+	x := chroma * (1 - math.Abs(math.Mod(c.H/60, 2)-1))
+	m := c.L - chroma/2
+
+	var r, g, b float64
+	switch {
+	case c.H < 60:
+		r, g, b = chroma, x, 0
+	case c.H < 120:
+		r, g, b = x, chroma, 0
+	case c.H < 180:
+		r, g, b = 0, chroma, x
+	case c.H < 240:
+		r, g, b = 0, x, chroma
+	case c.H < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	channel := func(v float64) uint8 { return uint8(math.Round((v + m) * 255)) }
+	return RGB{R: channel(r), G: channel(g), B: channel(b)}
+}
+
+func (c HSL) String() string {
+	return fmt.Sprintf("hsl(%s, %s, %s)", strconv.FormatFloat(math.Round(c.H*10)/10, 'f', -1, 64), formatPercent(c.S), formatPercent(c.L))
+}
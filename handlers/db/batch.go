@@ -0,0 +1,360 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+)
+
+// DynamoDB's limits on the number of keys in a BatchGetItem and requests in a BatchWriteItem call.
+const (
+	MaxBatchGetKeys       = 100
+	MaxBatchWriteRequests = 25
+)
+
+// BatchConfig controls how BatchGet and BatchWrite spread their chunks over workers and retry unprocessed items.
+type BatchConfig struct {
+	Workers    int
+	NewBackOff func() backoff.BackOff
+}
+
+type BatchOption = func(config BatchConfig) BatchConfig
+
+func WithBatchWorkers(workers int) BatchOption {
+	return func(config BatchConfig) BatchConfig {
+		config.Workers = workers
+		return config
+	}
+}
+
+// WithBatchBackOff sets the policy each chunk retries its unprocessed items with. A fresh BackOff is created per
+// chunk as they are stateful.
+func WithBatchBackOff(newBackOff func() backoff.BackOff) BatchOption {
+	return func(config BatchConfig) BatchConfig {
+		config.NewBackOff = newBackOff
+		return config
+	}
+}
+
+func batchConfigOf(options []BatchOption) BatchConfig {
+	config := BatchConfig{
+		Workers: 4,
+		NewBackOff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = 50 * time.Millisecond
+			b.MaxElapsedTime = 10 * time.Second
+			return b
+		},
+	}
+	for _, option := range options {
+		config = option(config)
+	}
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return config
+}
+
+// BatchFailure is an item a batch could not read or write. Key is set for BatchGet and Write for BatchWrite.
+type BatchFailure struct {
+	Key   map[string]types.AttributeValue
+	Write *types.WriteRequest
+	Err   error
+}
+
+// BatchError lists the items that failed when the rest of a batch succeeded. It unwraps to each failure's error,
+// so errors.Is(err, ErrThrottled) reports whether any item was left unprocessed after retrying.
+type BatchError struct {
+	Failures []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d batch items failed, first error: %v", len(e.Failures), e.Failures[0].Err)
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+var errUnprocessed = errors.New("unprocessed batch items")
+
+// BatchGet reads the items for keys into models in the order the keys were given, skipping keys with no item.
+// Keys are de-duplicated and read in chunks of MaxBatchGetKeys by a bounded pool of workers. Items that could not
+// be read are reported in a *BatchError after models has been filled with everything that was read.
+func (r *DynamoRepository) BatchGet(ctx context.Context, keys []map[string]types.AttributeValue, models interface{}, options ...BatchOption) error {
+	config := batchConfigOf(options)
+	if len(keys) == 0 {
+		return attributevalue.UnmarshalListOfMaps(nil, models)
+	}
+
+	names := keyNames(keys[0])
+	order := map[string]int{}
+	var unique []map[string]types.AttributeValue
+	for _, key := range keys {
+		signature := keySignature(key, names)
+		if _, ok := order[signature]; !ok {
+			order[signature] = len(unique)
+			unique = append(unique, key)
+		}
+	}
+
+	chunks := chunk(unique, MaxBatchGetKeys)
+	results := make([][]map[string]types.AttributeValue, len(chunks))
+	failures := make([][]BatchFailure, len(chunks))
+	forEachChunk(len(chunks), config.Workers, func(i int) {
+		results[i], failures[i] = r.batchGetChunk(ctx, chunks[i], config)
+	})
+
+	var items []map[string]types.AttributeValue
+	for _, result := range results {
+		items = append(items, result...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return order[keySignature(items[i], names)] < order[keySignature(items[j], names)]
+	})
+
+	if err := attributevalue.UnmarshalListOfMaps(items, models); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to unmarshal list of items")
+		return err
+	}
+	return batchError(ctx, failures)
+}
+
+func (r *DynamoRepository) batchGetChunk(ctx context.Context, keys []map[string]types.AttributeValue, config BatchConfig) ([]map[string]types.AttributeValue, []BatchFailure) {
+	var items []map[string]types.AttributeValue
+	pending := keys
+
+	err := retryUnprocessed(ctx, config, func() (int, error) {
+		out, err := r.Client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{r.Tablename: {Keys: pending}},
+		})
+		if err != nil {
+			return len(pending), err
+		}
+		items = append(items, out.Responses[r.Tablename]...)
+		pending = out.UnprocessedKeys[r.Tablename].Keys
+		return len(pending), nil
+	})
+	if err == nil {
+		return items, nil
+	}
+
+	failures := make([]BatchFailure, 0, len(pending))
+	for _, key := range pending {
+		failures = append(failures, BatchFailure{Key: key, Err: err})
+	}
+	return items, failures
+}
+
+// BatchWrite applies puts and deletes in chunks of MaxBatchWriteRequests using a bounded pool of workers. Unlike
+// TransactPut the writes are not atomic: requests that could not be applied are reported in a *BatchError. When
+// several requests write the same key only the last is applied, as DynamoDB rejects a chunk that repeats a key.
+func (r *DynamoRepository) BatchWrite(ctx context.Context, requests []types.WriteRequest, options ...BatchOption) error {
+	config := batchConfigOf(options)
+
+	chunks := chunk(lastWritePerKey(requests), MaxBatchWriteRequests)
+	failures := make([][]BatchFailure, len(chunks))
+	forEachChunk(len(chunks), config.Workers, func(i int) {
+		failures[i] = r.batchWriteChunk(ctx, chunks[i], config)
+	})
+
+	return batchError(ctx, failures)
+}
+
+func (r *DynamoRepository) batchWriteChunk(ctx context.Context, requests []types.WriteRequest, config BatchConfig) []BatchFailure {
+	pending := requests
+
+	err := retryUnprocessed(ctx, config, func() (int, error) {
+		out, err := r.Client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{r.Tablename: pending},
+		})
+		if err != nil {
+			return len(pending), err
+		}
+		pending = out.UnprocessedItems[r.Tablename]
+		return len(pending), nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	failures := make([]BatchFailure, 0, len(pending))
+	for i := range pending {
+		failures = append(failures, BatchFailure{Write: &pending[i], Err: err})
+	}
+	return failures
+}
+
+// pkSkNames are the key attributes of every table in this project.
+var pkSkNames = []string{"pk", "sk"}
+
+// lastWritePerKey drops every request that is followed by another for the same key, keeping the order of the rest.
+// Requests without a valid key are kept for DynamoDB to reject.
+func lastWritePerKey(requests []types.WriteRequest) []types.WriteRequest {
+	seen := map[string]bool{}
+	kept := make([]types.WriteRequest, 0, len(requests))
+	for i := len(requests) - 1; i >= 0; i-- {
+		signature, ok := writeSignature(requests[i])
+		if ok && seen[signature] {
+			continue
+		}
+		seen[signature] = ok
+		kept = append(kept, requests[i])
+	}
+	slices.Reverse(kept)
+	return kept
+}
+
+// writeSignature is the keySignature of the item a request writes, or false if the request has no valid key.
+func writeSignature(request types.WriteRequest) (string, bool) {
+	var key map[string]types.AttributeValue
+	switch {
+	case request.PutRequest != nil:
+		key = request.PutRequest.Item
+	case request.DeleteRequest != nil:
+		key = request.DeleteRequest.Key
+	}
+	for _, name := range pkSkNames {
+		if encodeKeyValue(key[name]) == "" {
+			return "", false
+		}
+	}
+	return keySignature(key, pkSkNames), true
+}
+
+// NewPutRequest marshals a model into a BatchWrite put.
+func NewPutRequest(model interface{}) (types.WriteRequest, error) {
+	av, err := attributevalue.MarshalMap(model)
+	if err != nil {
+		return types.WriteRequest{}, err
+	}
+	return types.WriteRequest{PutRequest: &types.PutRequest{Item: av}}, nil
+}
+
+func NewDeleteRequest(key map[string]types.AttributeValue) types.WriteRequest {
+	return types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+}
+
+// retryUnprocessed calls attempt until it reports no unprocessed items. Throttling is retried along with
+// unprocessed items; any other error fails the chunk straight away.
+func retryUnprocessed(ctx context.Context, config BatchConfig, attempt func() (int, error)) error {
+	err := backoff.Retry(func() error {
+		unprocessed, err := attempt()
+		if err != nil {
+			err = TranslateError(err)
+			if errors.Is(err, ErrThrottled) {
+				return err
+			}
+			return backoff.Permanent(err)
+		}
+		if unprocessed > 0 {
+			return errUnprocessed
+		}
+		return nil
+	}, backoff.WithContext(config.NewBackOff(), ctx))
+
+	if errors.Is(err, errUnprocessed) {
+		return NewThrottledError(errors.New("batch items were still unprocessed when retries were exhausted"))
+	}
+	return err
+}
+
+func batchError(ctx context.Context, failures [][]BatchFailure) error {
+	var all []BatchFailure
+	for _, f := range failures {
+		all = append(all, f...)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	err := &BatchError{Failures: all}
+	zerolog.Ctx(ctx).Err(err).Int("failures", len(all)).Msg("Failed to process all batch items")
+	return err
+}
+
+// forEachChunk calls fn for every chunk index using at most workers goroutines and waits for them to finish.
+func forEachChunk(chunks int, workers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < chunks; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < chunks; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+func chunk[T any](all []T, size int) [][]T {
+	var chunks [][]T
+	for size < len(all) {
+		all, chunks = all[size:], append(chunks, all[:size])
+	}
+	if len(all) > 0 {
+		chunks = append(chunks, all)
+	}
+	return chunks
+}
+
+func keyNames(key map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(key))
+	for name := range key {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func keySignature(it map[string]types.AttributeValue, names []string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, encodeKeyValue(it[name]))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// encodeKeyValue is a key attribute as a string that is equal for equal keys, such as numbers written as 1 and
+// 1.0. It is empty for values that cannot be keys.
+func encodeKeyValue(value types.AttributeValue) string {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		if v.Value == "" {
+			return ""
+		}
+		return "S" + v.Value
+	case *types.AttributeValueMemberN:
+		if r, ok := new(big.Rat).SetString(v.Value); ok {
+			return "N" + r.RatString()
+		}
+	case *types.AttributeValueMemberB:
+		if len(v.Value) > 0 {
+			return "B" + base64.StdEncoding.EncodeToString(v.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchRepository(batchLimit int) *DynamoRepository {
+	client := NewInMemoryDynamoDB(util.NewRealClock())
+	client.CreatePkSkTable(testTable, "ttl")
+	client.BatchLimit = batchLimit
+	repo := NewInstanceWithClient(client, testTable)
+	return &repo
+}
+
+func noDelay() backoff.BackOff { return &backoff.ZeroBackOff{} }
+
+func TestBatchWriteAndGet_RetryUnprocessedItems(t *testing.T) {
+	ctx := context.TODO()
+	// every call leaves most of its chunk unprocessed, forcing several retries per chunk
+	repo := newBatchRepository(7)
+	widgets := NewTable[widgetEntity](repo, PkSkKey("WIDGET"))
+
+	var entities []widgetEntity
+	var ids []string
+	for i := 0; i < 260; i++ {
+		id := fmt.Sprintf("%03d", i)
+		ids = append(ids, id)
+		entities = append(entities, widgetEntity{Pk: pk("WIDGET", id), Sk: pk("WIDGET", id), Name: "widget " + id})
+	}
+	require.NoError(t, widgets.BatchPut(ctx, entities, WithBatchBackOff(noDelay), WithBatchWorkers(3)))
+
+	// reversed with a duplicate and an unknown id to check ordering and de-duplication
+	var requested []string
+	for i := len(ids) - 1; i >= 0; i-- {
+		requested = append(requested, ids[i])
+	}
+	requested = append(requested, "missing", ids[0])
+
+	got, err := widgets.BatchGet(ctx, requested, WithBatchBackOff(noDelay))
+	require.NoError(t, err)
+	require.Len(t, got, 260)
+	assert.Equal(t, "widget 259", got[0].Name)
+	assert.Equal(t, "widget 000", got[259].Name)
+}
+
+func TestBatchGet_ReportsItemsLeftUnprocessed(t *testing.T) {
+	ctx := context.TODO()
+	repo := newBatchRepository(0)
+	widgets := NewTable[widgetEntity](repo, PkSkKey("WIDGET"))
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, widgets.Put(ctx, widgetEntity{Pk: pk("WIDGET", id), Sk: pk("WIDGET", id)}))
+	}
+	repo.Client.(*InMemoryDynamoDB).BatchLimit = 2
+
+	got, err := widgets.BatchGet(ctx, []string{"1", "2", "3"}, WithBatchBackOff(func() backoff.BackOff { return &backoff.StopBackOff{} }))
+
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.True(t, errors.Is(err, ErrThrottled))
+	require.Len(t, batchErr.Failures, 1)
+	assert.Equal(t, widgets.Key("3"), batchErr.Failures[0].Key)
+	assert.Len(t, got, 2, "items read before retries ran out are still returned")
+}
+
+func TestBatchWrite_ValidationErrorsAreNotRetried(t *testing.T) {
+	ctx := context.TODO()
+	repo := newBatchRepository(0)
+
+	err := repo.BatchWrite(ctx, []types.WriteRequest{
+		NewDeleteRequest(map[string]types.AttributeValue{"id": attrS("A")}),
+	}, WithBatchBackOff(noDelay))
+
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	assert.True(t, errors.Is(err, ErrValidationFailed))
+	require.NotNil(t, batchErr.Failures[0].Write)
+}
+
+func TestBatchWrite_LastWriteToAKeyWins(t *testing.T) {
+	ctx := context.TODO()
+	repo := newBatchRepository(0)
+	widgets := NewTable[widgetEntity](repo, PkSkKey("WIDGET"))
+
+	var requests []types.WriteRequest
+	for _, name := range []string{"first", "second"} {
+		for i := 0; i < 20; i++ {
+			id := fmt.Sprintf("%02d", i)
+			request, err := NewPutRequest(widgetEntity{Pk: pk("WIDGET", id), Sk: pk("WIDGET", id), Name: name})
+			require.NoError(t, err)
+			requests = append(requests, request)
+		}
+	}
+	requests = append(requests, NewDeleteRequest(widgets.Key("00")))
+
+	require.NoError(t, repo.BatchWrite(ctx, requests, WithBatchBackOff(noDelay)))
+
+	_, err := widgets.Get(ctx, "00")
+	assert.True(t, errors.Is(err, ErrNotFound), "the delete came after both puts")
+	got, err := widgets.Get(ctx, "19")
+	require.NoError(t, err)
+	assert.Equal(t, "second", got.Name)
+}
+
+func TestChunk(t *testing.T) {
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, chunk([]int{1, 2, 3, 4, 5}, 2))
+	assert.Nil(t, chunk([]int{}, 2))
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+const DynamoEndpointEnvKey = "DYNAMO_ENDPOINT"
+
+// DynamoDBConfig describes how to build a DynamoDB client. Zero values fall back to the AWS SDK defaults, so an
+// empty config talks to AWS using the default credential chain.
+type DynamoDBConfig struct {
+	// Endpoint overrides the service endpoint, e.g. http://localhost:8000 for DynamoDB Local.
+	Endpoint         string
+	Credentials      aws.CredentialsProvider
+	RetryMaxAttempts int
+	RetryMaxBackoff  time.Duration
+	HTTPClient       aws.HTTPClient
+	// AWSConfig replaces config.LoadDefaultConfig when the caller already has a loaded configuration.
+	AWSConfig *aws.Config
+}
+
+type DynamoDBOption = func(config DynamoDBConfig) DynamoDBConfig
+
+func WithEndpoint(endpoint string) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.Endpoint = endpoint
+		return config
+	}
+}
+
+func WithStaticCredentials(accessKeyID, secretAccessKey string) DynamoDBOption {
+	return WithCredentials(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""))
+}
+
+func WithCredentials(provider aws.CredentialsProvider) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.Credentials = provider
+		return config
+	}
+}
+
+func WithRetryMaxAttempts(attempts int) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.RetryMaxAttempts = attempts
+		return config
+	}
+}
+
+func WithRetryMaxBackoff(backoff time.Duration) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.RetryMaxBackoff = backoff
+		return config
+	}
+}
+
+func WithHTTPClient(client aws.HTTPClient) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.HTTPClient = client
+		return config
+	}
+}
+
+func WithAWSConfig(awsConfig aws.Config) DynamoDBOption {
+	return func(config DynamoDBConfig) DynamoDBConfig {
+		config.AWSConfig = &awsConfig
+		return config
+	}
+}
+
+// NewDynamoDB builds a client for the region from the given options, returning an error rather than exiting
+// when the AWS configuration cannot be loaded.
+func NewDynamoDB(ctx context.Context, region string, options ...DynamoDBOption) (*dynamodb.Client, error) {
+	var dbConfig DynamoDBConfig
+	for _, option := range options {
+		dbConfig = option(dbConfig)
+	}
+
+	var awsConfig aws.Config
+	if dbConfig.AWSConfig != nil {
+		awsConfig = dbConfig.AWSConfig.Copy()
+		if len(region) > 0 {
+			awsConfig.Region = region
+		}
+	} else {
+		loaded, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+		if err != nil {
+			return nil, err
+		}
+		awsConfig = loaded
+	}
+
+	return dynamodb.NewFromConfig(awsConfig, func(o *dynamodb.Options) {
+		if len(dbConfig.Endpoint) > 0 {
+			o.BaseEndpoint = aws.String(dbConfig.Endpoint)
+		}
+		if dbConfig.Credentials != nil {
+			o.Credentials = dbConfig.Credentials
+		}
+		if dbConfig.HTTPClient != nil {
+			o.HTTPClient = dbConfig.HTTPClient
+		}
+		if dbConfig.RetryMaxAttempts > 0 || dbConfig.RetryMaxBackoff > 0 {
+			o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+				if dbConfig.RetryMaxAttempts > 0 {
+					so.MaxAttempts = dbConfig.RetryMaxAttempts
+				}
+				if dbConfig.RetryMaxBackoff > 0 {
+					so.MaxBackoff = dbConfig.RetryMaxBackoff
+				}
+			})
+		}
+	}), nil
+}
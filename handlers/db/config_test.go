@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstanceWithValues_UsesEndpointOverride(t *testing.T) {
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	repo, err := NewInstanceWithValues(context.TODO(), "local", "cmyk-users",
+		WithEndpoint(server.URL),
+		WithStaticCredentials("key-id", "secret"),
+		WithRetryMaxAttempts(1),
+		WithHTTPClient(server.Client()),
+	)
+	require.NoError(t, err)
+
+	var entity userEntity
+	err = repo.GetByKey(context.TODO(), map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "USERNAME#a"},
+		"sk": &types.AttributeValueMemberS{Value: "USERNAME#a"},
+	}, &entity)
+
+	var notFound NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "DynamoDB_20120810.GetItem", target)
+}
+
+func TestNewInstance_RequiresTablename(t *testing.T) {
+	t.Setenv("CMYK_MISSING_TABLE", "")
+
+	_, err := NewInstance(context.TODO(), "local", "CMYK_MISSING_TABLE")
+	assert.ErrorContains(t, err, "CMYK_MISSING_TABLE")
+}
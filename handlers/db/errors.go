@@ -0,0 +1,183 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Sentinels for the repository error taxonomy. Every typed error below reports errors.Is true for its sentinel
+// and unwraps to the underlying AWS error, so callers can match on either.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrConditionFailed  = errors.New("condition failed")
+	ErrThrottled        = errors.New("throttled")
+	ErrValidationFailed = errors.New("validation failed")
+)
+
+type NotFoundError struct {
+	StatusCode int
+	Err        error
+}
+
+func NewNotFoundError(err error) NotFoundError {
+	return NotFoundError{
+		StatusCode: 404,
+		Err:        err,
+	}
+}
+func (m NotFoundError) Error() string {
+	return m.Err.Error()
+}
+func (m NotFoundError) Unwrap() error        { return m.Err }
+func (m NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+type AlreadyExistsError struct {
+	StatusCode int
+	Err        error
+}
+
+func NewAlreadyExistsError(err error) AlreadyExistsError {
+	return AlreadyExistsError{
+		StatusCode: 409,
+		Err:        err,
+	}
+}
+func (m AlreadyExistsError) Error() string {
+	return m.Err.Error()
+}
+func (m AlreadyExistsError) Unwrap() error        { return m.Err }
+func (m AlreadyExistsError) Is(target error) bool { return target == ErrAlreadyExists }
+
+// ConditionFailedError is returned when a condition expression, or one of the conditions in a transaction,
+// did not hold. Reasons lists the failed transaction items as formatted by ExtractCancellationReasons.
+type ConditionFailedError struct {
+	StatusCode int
+	Reasons    string
+	Err        error
+}
+
+func NewConditionFailedError(err error, reasons string) ConditionFailedError {
+	return ConditionFailedError{
+		StatusCode: 412,
+		Reasons:    reasons,
+		Err:        err,
+	}
+}
+func (m ConditionFailedError) Error() string {
+	return m.Err.Error()
+}
+func (m ConditionFailedError) Unwrap() error        { return m.Err }
+func (m ConditionFailedError) Is(target error) bool { return target == ErrConditionFailed }
+
+type ThrottledError struct {
+	StatusCode int
+	Err        error
+}
+
+func NewThrottledError(err error) ThrottledError {
+	return ThrottledError{
+		StatusCode: 429,
+		Err:        err,
+	}
+}
+func (m ThrottledError) Error() string {
+	return m.Err.Error()
+}
+func (m ThrottledError) Unwrap() error        { return m.Err }
+func (m ThrottledError) Is(target error) bool { return target == ErrThrottled }
+
+type ValidationFailedError struct {
+	StatusCode int
+	Err        error
+}
+
+func NewValidationFailedError(err error) ValidationFailedError {
+	return ValidationFailedError{
+		StatusCode: 400,
+		Err:        err,
+	}
+}
+func (m ValidationFailedError) Error() string {
+	return m.Err.Error()
+}
+func (m ValidationFailedError) Unwrap() error        { return m.Err }
+func (m ValidationFailedError) Is(target error) bool { return target == ErrValidationFailed }
+
+// TranslateError maps a DynamoDB failure onto the repository error taxonomy. Errors that are already part of
+// the taxonomy, and errors it does not recognise, are returned unchanged.
+func TranslateError(err error) error {
+	if err == nil || StatusCode(err) != 500 {
+		return err
+	}
+
+	var conditionalCheckFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionalCheckFailed) {
+		return NewConditionFailedError(err, "")
+	}
+
+	var transactionCancelled *types.TransactionCanceledException
+	if errors.As(err, &transactionCancelled) {
+		return translateCancellation(err, transactionCancelled.CancellationReasons)
+	}
+
+	var throughputExceeded *types.ProvisionedThroughputExceededException
+	var requestLimitExceeded *types.RequestLimitExceeded
+	if errors.As(err, &throughputExceeded) || errors.As(err, &requestLimitExceeded) {
+		return NewThrottledError(err)
+	}
+
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.ErrorCode() {
+		case "ThrottlingException", "TransactionConflictException", "TransactionInProgressException":
+			return NewThrottledError(err)
+		case "ValidationException":
+			return NewValidationFailedError(err)
+		}
+	}
+
+	return err
+}
+
+// translateCancellation classifies a cancelled transaction by its most actionable reason: a failed condition is
+// reported in preference to throttling or conflicts with other transactions, which callers may simply retry.
+func translateCancellation(err error, reasons []types.CancellationReason) error {
+	codes := map[string]bool{}
+	for _, r := range reasons {
+		if r.Code != nil {
+			codes[*r.Code] = true
+		}
+	}
+
+	switch {
+	case codes["ConditionalCheckFailed"]:
+		return NewConditionFailedError(err, ExtractCancellationReasons(reasons))
+	case codes["ValidationError"], codes["ItemCollectionSizeLimitExceeded"]:
+		return NewValidationFailedError(err)
+	case codes["ThrottlingError"], codes["ProvisionedThroughputExceeded"], codes["TransactionConflict"]:
+		return NewThrottledError(err)
+	}
+	return err
+}
+
+// StatusCode returns the HTTP style status of an error in the taxonomy, or 500 for anything else.
+func StatusCode(err error) int {
+	switch {
+	case err == nil:
+		return 200
+	case errors.Is(err, ErrNotFound):
+		return 404
+	case errors.Is(err, ErrAlreadyExists):
+		return 409
+	case errors.Is(err, ErrConditionFailed):
+		return 412
+	case errors.Is(err, ErrThrottled):
+		return 429
+	case errors.Is(err, ErrValidationFailed):
+		return 400
+	}
+	return 500
+}
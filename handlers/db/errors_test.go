@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateError(t *testing.T) {
+	cancelled := func(codes ...string) error {
+		reasons := make([]types.CancellationReason, 0, len(codes))
+		for _, code := range codes {
+			reasons = append(reasons, types.CancellationReason{Code: aws.String(code), Message: aws.String(code)})
+		}
+		return &types.TransactionCanceledException{Message: aws.String("cancelled"), CancellationReasons: reasons}
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		want   error
+		status int
+	}{
+		{
+			name:   "conditional check failures are ConditionFailed",
+			err:    fmt.Errorf("operation error: %w", &types.ConditionalCheckFailedException{Message: aws.String("failed")}),
+			want:   ErrConditionFailed,
+			status: 412,
+		}, {
+			name:   "cancelled transactions with a failed condition are ConditionFailed",
+			err:    cancelled("None", "ConditionalCheckFailed"),
+			want:   ErrConditionFailed,
+			status: 412,
+		}, {
+			name:   "cancelled transactions that conflict are Throttled",
+			err:    cancelled("TransactionConflict", "None"),
+			want:   ErrThrottled,
+			status: 429,
+		}, {
+			name:   "provisioned throughput exceeded is Throttled",
+			err:    &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")},
+			want:   ErrThrottled,
+			status: 429,
+		}, {
+			name:   "throttling exceptions are Throttled",
+			err:    &smithy.GenericAPIError{Code: "ThrottlingException", Message: "slow down"},
+			want:   ErrThrottled,
+			status: 429,
+		}, {
+			name:   "validation exceptions are ValidationFailed",
+			err:    &smithy.GenericAPIError{Code: "ValidationException", Message: "bad key"},
+			want:   ErrValidationFailed,
+			status: 400,
+		}, {
+			name:   "not found errors are unchanged",
+			err:    NewNotFoundError(errors.New("missing")),
+			want:   ErrNotFound,
+			status: 404,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TranslateError(tt.err)
+			assert.True(t, errors.Is(got, tt.want), "TranslateError() = %v, want %v", got, tt.want)
+			assert.Equal(t, tt.status, StatusCode(got))
+		})
+	}
+
+	unknown := errors.New("boom")
+	assert.Equal(t, unknown, TranslateError(unknown))
+	assert.Equal(t, 500, StatusCode(unknown))
+}
+
+func TestTranslateError_KeepsTheAWSErrorReachable(t *testing.T) {
+	err := TranslateError(&types.TransactionCanceledException{
+		Message:             aws.String("cancelled"),
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")}},
+	})
+
+	var conditionFailed ConditionFailedError
+	require.True(t, errors.As(err, &conditionFailed))
+	assert.Contains(t, conditionFailed.Reasons, "ConditionalCheckFailed")
+
+	var transactionCancelled *types.TransactionCanceledException
+	assert.True(t, errors.As(err, &transactionCancelled))
+}
+
+func TestAddUser_DuplicateIsAlreadyExists(t *testing.T) {
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u := util.RandomTestUser(util.WithCreatedAt(time.Now()))
+	_, err := repo.AddTestUser(ctx, u, model.Short)
+	require.NoError(t, err)
+
+	_, err = repo.AddTestUser(ctx, u, model.Short)
+	var alreadyExists AlreadyExistsError
+	assert.True(t, errors.As(err, &alreadyExists))
+	assert.Equal(t, 409, StatusCode(err))
+}
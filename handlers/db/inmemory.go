@@ -0,0 +1,979 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/projects/cmyk-api/handlers/util"
+)
+
+// InMemoryDynamoDB is a DynamoDBClient that keeps its tables in memory so repositories can be tested without
+// DynamoDB Local or AWS. It supports key validation, condition/filter/key condition expressions, update
+// expressions, global secondary indexes, all-or-nothing transactions and TTL expiry driven by the given clock.
+type InMemoryDynamoDB struct {
+	mu     sync.Mutex
+	clock  util.Clock
+	tables map[string]*memTable
+	// BatchLimit caps how many keys or writes a single BatchGetItem or BatchWriteItem call processes. The rest are
+	// returned as unprocessed, as DynamoDB does when a table is throttled, so callers' retries can be tested.
+	BatchLimit int
+	// ExpireItems deletes items as soon as their TTL passes. By default expired items stay visible, as they do in
+	// DynamoDB, which deletes them up to 48 hours late, and in DynamoDB Local, which never deletes them.
+	ExpireItems bool
+}
+
+type memKeySchema struct {
+	hashKey  string
+	rangeKey string
+}
+
+type memTable struct {
+	keys         memKeySchema
+	indexes      map[string]memKeySchema
+	ttlAttribute string
+	items        map[string]item
+	// description is what DescribeTable returns, kept in step with the indexes.
+	description types.TableDescription
+}
+
+func NewInMemoryDynamoDB(clock util.Clock) *InMemoryDynamoDB {
+	return &InMemoryDynamoDB{
+		clock:  clock,
+		tables: map[string]*memTable{},
+	}
+}
+
+// NewInMemoryRepository creates a DynamoRepository over a fresh InMemoryDynamoDB holding a single pk/sk table
+// with TTL enabled on the ttl attribute and the given indexes, matching the tables declared in serverless.yml.
+func NewInMemoryRepository(clock util.Clock, tablename string, indexes ...types.GlobalSecondaryIndex) *DynamoRepository {
+	client := NewInMemoryDynamoDB(clock)
+	client.CreatePkSkTable(tablename, "ttl", indexes...)
+	db := NewInstanceWithClient(client, tablename)
+	return &db
+}
+
+// CreatePkSkTable creates a table keyed on pk (HASH) and sk (RANGE), the layout every table in this project uses.
+func (m *InMemoryDynamoDB) CreatePkSkTable(tablename string, ttlAttribute string, indexes ...types.GlobalSecondaryIndex) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table := newMemTable(tablename, []types.KeySchemaElement{
+		{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+		{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+	}, indexes)
+	table.ttlAttribute = ttlAttribute
+	m.tables[tablename] = table
+}
+
+func (m *InMemoryDynamoDB) CreateTable(_ context.Context, params *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tablename := aws.ToString(params.TableName)
+	if _, exists := m.tables[tablename]; exists {
+		return nil, &types.ResourceInUseException{Message: aws.String(fmt.Sprintf("Table already exists: %s", tablename))}
+	}
+
+	table := newMemTable(tablename, params.KeySchema, params.GlobalSecondaryIndexes)
+	table.description.AttributeDefinitions = params.AttributeDefinitions
+	m.tables[tablename] = table
+
+	description := table.description
+	return &dynamodb.CreateTableOutput{TableDescription: &description}, nil
+}
+
+func newMemTable(tablename string, keySchema []types.KeySchemaElement, indexes []types.GlobalSecondaryIndex) *memTable {
+	table := &memTable{
+		keys:    keySchemaOf(keySchema),
+		indexes: map[string]memKeySchema{},
+		items:   map[string]item{},
+		description: types.TableDescription{
+			TableName:   aws.String(tablename),
+			KeySchema:   keySchema,
+			TableStatus: types.TableStatusActive,
+		},
+	}
+	for _, gsi := range indexes {
+		table.addIndex(gsi)
+	}
+	return table
+}
+
+func (t *memTable) addIndex(gsi types.GlobalSecondaryIndex) {
+	t.indexes[aws.ToString(gsi.IndexName)] = keySchemaOf(gsi.KeySchema)
+	t.description.GlobalSecondaryIndexes = append(t.description.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+		IndexName:   gsi.IndexName,
+		KeySchema:   gsi.KeySchema,
+		Projection:  gsi.Projection,
+		IndexStatus: types.IndexStatusActive,
+	})
+}
+
+func (t *memTable) deleteIndex(name string) bool {
+	if _, ok := t.indexes[name]; !ok {
+		return false
+	}
+	delete(t.indexes, name)
+	var described []types.GlobalSecondaryIndexDescription
+	for _, gsi := range t.description.GlobalSecondaryIndexes {
+		if aws.ToString(gsi.IndexName) != name {
+			described = append(described, gsi)
+		}
+	}
+	t.description.GlobalSecondaryIndexes = described
+	return true
+}
+
+func (m *InMemoryDynamoDB) DescribeTable(_ context.Context, params *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	description := table.description
+	description.ItemCount = aws.Int64(int64(len(table.items)))
+	return &dynamodb.DescribeTableOutput{Table: &description}, nil
+}
+
+// UpdateTable creates and deletes global secondary indexes, which become active straight away. Items already in
+// the table are indexed as soon as the index exists.
+func (m *InMemoryDynamoDB) UpdateTable(_ context.Context, params *dynamodb.UpdateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			name := aws.ToString(update.Create.IndexName)
+			if _, exists := table.indexes[name]; exists {
+				return nil, validationError(fmt.Sprintf("Attempting to create an index which already exists: %s", name))
+			}
+			table.addIndex(types.GlobalSecondaryIndex{
+				IndexName:  update.Create.IndexName,
+				KeySchema:  update.Create.KeySchema,
+				Projection: update.Create.Projection,
+			})
+		case update.Delete != nil:
+			name := aws.ToString(update.Delete.IndexName)
+			if !table.deleteIndex(name) {
+				return nil, &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf("Requested resource not found: Index: %s not found", name))}
+			}
+		default:
+			return nil, validationError("only index creates and deletes are supported")
+		}
+	}
+	if len(params.AttributeDefinitions) > 0 {
+		table.description.AttributeDefinitions = mergeAttributeDefinitions(table.description.AttributeDefinitions, params.AttributeDefinitions)
+	}
+
+	description := table.description
+	return &dynamodb.UpdateTableOutput{TableDescription: &description}, nil
+}
+
+func mergeAttributeDefinitions(existing, added []types.AttributeDefinition) []types.AttributeDefinition {
+	merged := append([]types.AttributeDefinition{}, existing...)
+	for _, definition := range added {
+		known := false
+		for _, e := range merged {
+			known = known || aws.ToString(e.AttributeName) == aws.ToString(definition.AttributeName)
+		}
+		if !known {
+			merged = append(merged, definition)
+		}
+	}
+	return merged
+}
+
+func (m *InMemoryDynamoDB) DeleteTable(_ context.Context, params *dynamodb.DeleteTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(m.tables, aws.ToString(params.TableName))
+
+	description := table.description
+	description.TableStatus = types.TableStatusDeleting
+	return &dynamodb.DeleteTableOutput{TableDescription: &description}, nil
+}
+
+func (m *InMemoryDynamoDB) DescribeTimeToLive(_ context.Context, params *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	description := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if table.ttlAttribute != "" {
+		description = &types.TimeToLiveDescription{
+			AttributeName:    aws.String(table.ttlAttribute),
+			TimeToLiveStatus: types.TimeToLiveStatusEnabled,
+		}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: description}, nil
+}
+
+func keySchemaOf(elements []types.KeySchemaElement) memKeySchema {
+	var schema memKeySchema
+	for _, e := range elements {
+		if e.KeyType == types.KeyTypeHash {
+			schema.hashKey = aws.ToString(e.AttributeName)
+		} else {
+			schema.rangeKey = aws.ToString(e.AttributeName)
+		}
+	}
+	return schema
+}
+
+func (m *InMemoryDynamoDB) UpdateTimeToLive(_ context.Context, params *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	table.ttlAttribute = ""
+	if aws.ToBool(params.TimeToLiveSpecification.Enabled) {
+		table.ttlAttribute = aws.ToString(params.TimeToLiveSpecification.AttributeName)
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: params.TimeToLiveSpecification}, nil
+}
+
+func (m *InMemoryDynamoDB) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := table.keyOf(params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := m.live(table, id)
+	if existing == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: copyItem(existing)}, nil
+}
+
+func (m *InMemoryDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := table.keyOf(params.Item, false)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := m.live(table, id)
+	if err := checkCondition(existing, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	table.items[id] = copyItem(params.Item)
+
+	out := &dynamodb.PutItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && existing != nil {
+		out.Attributes = copyItem(existing)
+	}
+	return out, nil
+}
+
+func (m *InMemoryDynamoDB) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, updated, err := m.prepareUpdate(table, params.Key, aws.ToString(params.UpdateExpression), params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := table.items[id]
+	table.items[id] = updated
+
+	out := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case types.ReturnValueAllOld:
+		if existing != nil {
+			out.Attributes = copyItem(existing)
+		}
+	case types.ReturnValueAllNew, types.ReturnValueUpdatedNew:
+		out.Attributes = copyItem(updated)
+	}
+	return out, nil
+}
+
+func (m *InMemoryDynamoDB) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := table.keyOf(params.Key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := m.live(table, id)
+	if err := checkCondition(existing, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+
+	delete(table.items, id)
+
+	out := &dynamodb.DeleteItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && existing != nil {
+		out.Attributes = copyItem(existing)
+	}
+	return out, nil
+}
+
+func (m *InMemoryDynamoDB) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for _, request := range params.RequestItems {
+		total += len(request.Keys)
+	}
+	if total == 0 || total > 100 {
+		return nil, validationError("Too many items requested for the BatchGetItem call")
+	}
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	processed := 0
+	for _, tablename := range sortedKeys(params.RequestItems) {
+		table, err := m.table(aws.String(tablename))
+		if err != nil {
+			return nil, err
+		}
+
+		request := params.RequestItems[tablename]
+		seen := map[string]bool{}
+		var unprocessed []map[string]types.AttributeValue
+		for _, key := range request.Keys {
+			id, err := table.keyOf(key, true)
+			if err != nil {
+				return nil, err
+			}
+			if seen[id] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[id] = true
+
+			if m.BatchLimit > 0 && processed >= m.BatchLimit {
+				unprocessed = append(unprocessed, copyItem(key))
+				continue
+			}
+			processed++
+			if existing := m.live(table, id); existing != nil {
+				out.Responses[tablename] = append(out.Responses[tablename], copyItem(existing))
+			}
+		}
+
+		if len(unprocessed) > 0 {
+			request.Keys = unprocessed
+			out.UnprocessedKeys[tablename] = request
+		}
+	}
+	return out, nil
+}
+
+func (m *InMemoryDynamoDB) BatchWriteItem(_ context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for _, requests := range params.RequestItems {
+		total += len(requests)
+	}
+	if total == 0 || total > 25 {
+		return nil, validationError("Too many items requested for the BatchWriteItem call")
+	}
+
+	type write struct {
+		table *memTable
+		id    string
+		item  item
+	}
+
+	// validate every request before applying any, as DynamoDB rejects the whole batch on a malformed request
+	var writes []write
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for _, tablename := range sortedKeys(params.RequestItems) {
+		table, err := m.table(aws.String(tablename))
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		for _, request := range params.RequestItems[tablename] {
+			var id string
+			var it item
+			switch {
+			case request.PutRequest != nil:
+				id, err = table.keyOf(request.PutRequest.Item, false)
+				it = request.PutRequest.Item
+			case request.DeleteRequest != nil:
+				id, err = table.keyOf(request.DeleteRequest.Key, true)
+			default:
+				err = validationError("A write request must contain a PutRequest or DeleteRequest")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if seen[id] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[id] = true
+
+			if m.BatchLimit > 0 && len(writes) >= m.BatchLimit {
+				out.UnprocessedItems[tablename] = append(out.UnprocessedItems[tablename], request)
+				continue
+			}
+			writes = append(writes, write{table: table, id: id, item: it})
+		}
+	}
+
+	for _, w := range writes {
+		if w.item == nil {
+			delete(w.table.items, w.id)
+		} else {
+			w.table.items[w.id] = copyItem(w.item)
+		}
+	}
+	return out, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *InMemoryDynamoDB) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.KeyConditionExpression == nil {
+		return nil, validationError("KeyConditionExpression must be provided")
+	}
+	keyCondition, err := parseCondition(aws.ToString(params.KeyConditionExpression), params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+
+	page, err := m.read(table, aws.ToString(params.IndexName), keyCondition, params.FilterExpression,
+		params.ExpressionAttributeNames, params.ExpressionAttributeValues, params.ExclusiveStartKey, params.Limit,
+		params.ScanIndexForward == nil || *params.ScanIndexForward)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.QueryOutput{
+		Items:            page.items,
+		Count:            int32(len(page.items)),
+		ScannedCount:     page.scanned,
+		LastEvaluatedKey: page.lastEvaluatedKey,
+	}, nil
+}
+
+func (m *InMemoryDynamoDB) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := m.read(table, aws.ToString(params.IndexName), nil, params.FilterExpression,
+		params.ExpressionAttributeNames, params.ExpressionAttributeValues, params.ExclusiveStartKey, params.Limit, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.ScanOutput{
+		Items:            page.items,
+		Count:            int32(len(page.items)),
+		ScannedCount:     page.scanned,
+		LastEvaluatedKey: page.lastEvaluatedKey,
+	}, nil
+}
+
+// TransactWriteItems checks every condition before applying any write, cancelling the whole transaction with the
+// per-item reasons DynamoDB would report when one of them fails.
+func (m *InMemoryDynamoDB) TransactWriteItems(_ context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > 100 {
+		return nil, validationError("TransactItems must contain between 1 and 100 items")
+	}
+
+	type write struct {
+		table   *memTable
+		id      string
+		updated item
+	}
+
+	writes := make([]write, 0, len(params.TransactItems))
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	seen := map[string]bool{}
+	cancelled := false
+
+	for i, transactItem := range params.TransactItems {
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+
+		var (
+			tablename  *string
+			key        item
+			expression *string
+			names      map[string]string
+			values     map[string]types.AttributeValue
+		)
+		switch {
+		case transactItem.Put != nil:
+			tablename, key, expression = transactItem.Put.TableName, transactItem.Put.Item, transactItem.Put.ConditionExpression
+			names, values = transactItem.Put.ExpressionAttributeNames, transactItem.Put.ExpressionAttributeValues
+		case transactItem.Update != nil:
+			tablename, key, expression = transactItem.Update.TableName, transactItem.Update.Key, transactItem.Update.ConditionExpression
+			names, values = transactItem.Update.ExpressionAttributeNames, transactItem.Update.ExpressionAttributeValues
+		case transactItem.Delete != nil:
+			tablename, key, expression = transactItem.Delete.TableName, transactItem.Delete.Key, transactItem.Delete.ConditionExpression
+			names, values = transactItem.Delete.ExpressionAttributeNames, transactItem.Delete.ExpressionAttributeValues
+		case transactItem.ConditionCheck != nil:
+			tablename, key, expression = transactItem.ConditionCheck.TableName, transactItem.ConditionCheck.Key, transactItem.ConditionCheck.ConditionExpression
+			names, values = transactItem.ConditionCheck.ExpressionAttributeNames, transactItem.ConditionCheck.ExpressionAttributeValues
+		default:
+			return nil, validationError("TransactItems can only contain one of Put, Update, Delete or ConditionCheck")
+		}
+
+		table, err := m.table(tablename)
+		if err != nil {
+			return nil, err
+		}
+		id, err := table.keyOf(key, transactItem.Put == nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[aws.ToString(tablename)+"/"+id] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[aws.ToString(tablename)+"/"+id] = true
+
+		existing := m.live(table, id)
+		if transactItem.Update != nil {
+			_, updated, err := m.prepareUpdate(table, key, aws.ToString(transactItem.Update.UpdateExpression), expression, names, values)
+			if err != nil {
+				if isConditionalCheckFailed(err) {
+					reasons[i] = conditionalCheckFailedReason()
+					cancelled = true
+					continue
+				}
+				return nil, err
+			}
+			writes = append(writes, write{table: table, id: id, updated: updated})
+			continue
+		}
+
+		if err := checkCondition(existing, expression, names, values); err != nil {
+			if isConditionalCheckFailed(err) {
+				reasons[i] = conditionalCheckFailedReason()
+				cancelled = true
+				continue
+			}
+			return nil, err
+		}
+
+		switch {
+		case transactItem.Put != nil:
+			writes = append(writes, write{table: table, id: id, updated: copyItem(transactItem.Put.Item)})
+		case transactItem.Delete != nil:
+			writes = append(writes, write{table: table, id: id})
+		}
+	}
+
+	if cancelled {
+		codes := make([]string, 0, len(reasons))
+		for _, r := range reasons {
+			codes = append(codes, aws.ToString(r.Code))
+		}
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, w := range writes {
+		if w.updated == nil {
+			delete(w.table.items, w.id)
+		} else {
+			w.table.items[w.id] = w.updated
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func conditionalCheckFailedReason() types.CancellationReason {
+	return types.CancellationReason{
+		Code:    aws.String("ConditionalCheckFailed"),
+		Message: aws.String("The conditional request failed"),
+	}
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var conditionalCheckFailed *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionalCheckFailed)
+}
+
+func (m *InMemoryDynamoDB) table(tablename *string) (*memTable, error) {
+	table, ok := m.tables[aws.ToString(tablename)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf("Requested resource not found: Table: %s not found", aws.ToString(tablename)))}
+	}
+	return table, nil
+}
+
+// live returns the stored item for the key. Items whose TTL has passed are treated as deleted when ExpireItems is
+// set.
+func (m *InMemoryDynamoDB) live(table *memTable, id string) item {
+	existing, ok := table.items[id]
+	if !ok {
+		return nil
+	}
+	if m.ExpireItems && m.expired(table, existing) {
+		delete(table.items, id)
+		return nil
+	}
+	return existing
+}
+
+func (m *InMemoryDynamoDB) expired(table *memTable, it item) bool {
+	if table.ttlAttribute == "" {
+		return false
+	}
+	ttl, ok := it[table.ttlAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	expiry, ok := new(big.Rat).SetString(ttl.Value)
+	if !ok || expiry.Sign() <= 0 {
+		return false
+	}
+	return expiry.Cmp(new(big.Rat).SetInt64(m.clock.Now().Unix())) <= 0
+}
+
+func (m *InMemoryDynamoDB) prepareUpdate(table *memTable, key item, updateExpression string, conditionExpression *string,
+	names map[string]string, values map[string]types.AttributeValue) (string, item, error) {
+
+	id, err := table.keyOf(key, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	existing := m.live(table, id)
+	if err := checkCondition(existing, conditionExpression, names, values); err != nil {
+		return "", nil, err
+	}
+
+	actions, err := parseUpdate(updateExpression, names, values)
+	if err != nil {
+		return "", nil, validationError(err.Error())
+	}
+
+	original := copyItem(key)
+	if existing != nil {
+		original = copyItem(existing)
+	}
+	updated := copyItem(original)
+
+	for _, action := range actions {
+		if name := action.path[0].name; name == table.keys.hashKey || name == table.keys.rangeKey {
+			return "", nil, validationError(fmt.Sprintf("Cannot update attribute %s. This attribute is part of the key", name))
+		}
+		if err := action.apply(original, updated); err != nil {
+			return "", nil, validationError(err.Error())
+		}
+	}
+	return id, updated, nil
+}
+
+func checkCondition(existing item, expression *string, names map[string]string, values map[string]types.AttributeValue) error {
+	if expression == nil {
+		return nil
+	}
+
+	c, err := parseCondition(*expression, names, values)
+	if err != nil {
+		return validationError(err.Error())
+	}
+
+	if existing == nil {
+		existing = item{}
+	}
+	ok, err := c(existing)
+	if err != nil {
+		return validationError(err.Error())
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return nil
+}
+
+type memPage struct {
+	items            []item
+	scanned          int32
+	lastEvaluatedKey item
+}
+
+// read implements Query and Scan over either the table or one of its indexes. Limit bounds the number of items
+// evaluated before the filter is applied, as it does in DynamoDB.
+func (m *InMemoryDynamoDB) read(table *memTable, indexName string, keyCondition condition, filterExpression *string,
+	names map[string]string, values map[string]types.AttributeValue, exclusiveStartKey item, limit *int32, forward bool) (*memPage, error) {
+
+	keys := table.keys
+	if indexName != "" {
+		index, ok := table.indexes[indexName]
+		if !ok {
+			return nil, validationError(fmt.Sprintf("The table does not have the specified index: %s", indexName))
+		}
+		keys = index
+	}
+
+	filter, err := parseCondition(aws.ToString(filterExpression), names, values)
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+
+	var candidates []item
+	for id := range table.items {
+		it := m.live(table, id)
+		if it == nil {
+			continue
+		}
+		if _, ok := it[keys.hashKey]; !ok {
+			continue
+		}
+		if keys.rangeKey != "" {
+			if _, ok := it[keys.rangeKey]; !ok {
+				continue
+			}
+		}
+		if keyCondition != nil {
+			ok, err := keyCondition(it)
+			if err != nil {
+				return nil, validationError(err.Error())
+			}
+			if !ok {
+				continue
+			}
+		}
+		candidates = append(candidates, it)
+	}
+
+	compare := table.ordering(keys, indexName != "")
+	sort.Slice(candidates, func(i, j int) bool {
+		if forward {
+			return compare(candidates[i], candidates[j]) < 0
+		}
+		return compare(candidates[i], candidates[j]) > 0
+	})
+
+	if exclusiveStartKey != nil {
+		start := 0
+		for start < len(candidates) {
+			cmp := compare(candidates[start], exclusiveStartKey)
+			if (forward && cmp > 0) || (!forward && cmp < 0) {
+				break
+			}
+			start++
+		}
+		candidates = candidates[start:]
+	}
+
+	page := &memPage{items: []item{}}
+	for _, it := range candidates {
+		if limit != nil && page.scanned >= *limit {
+			break
+		}
+		page.scanned++
+
+		ok, err := filter(it)
+		if err != nil {
+			return nil, validationError(err.Error())
+		}
+		if ok {
+			page.items = append(page.items, copyItem(it))
+		}
+	}
+	if limit != nil && page.scanned > 0 && page.scanned == *limit {
+		page.lastEvaluatedKey = table.lastEvaluatedKey(candidates[page.scanned-1], keys)
+	}
+	return page, nil
+}
+
+// ordering sorts items by partition then sort key. Index reads fall back to the table key so items sharing
+// index keys still have a stable order that an ExclusiveStartKey can resume from.
+func (t *memTable) ordering(keys memKeySchema, index bool) func(a, b item) int {
+	return func(a, b item) int {
+		if cmp := strings.Compare(encodeKeyValue(a[keys.hashKey]), encodeKeyValue(b[keys.hashKey])); cmp != 0 {
+			return cmp
+		}
+		if keys.rangeKey != "" {
+			if cmp, _ := compareAttributeValues(a[keys.rangeKey], b[keys.rangeKey]); cmp != 0 {
+				return cmp
+			}
+		}
+		if index {
+			if cmp := strings.Compare(encodeKeyValue(a[t.keys.hashKey]), encodeKeyValue(b[t.keys.hashKey])); cmp != 0 {
+				return cmp
+			}
+			if t.keys.rangeKey != "" {
+				cmp, _ := compareAttributeValues(a[t.keys.rangeKey], b[t.keys.rangeKey])
+				return cmp
+			}
+		}
+		return 0
+	}
+}
+
+func (t *memTable) lastEvaluatedKey(it item, keys memKeySchema) item {
+	key := item{}
+	for _, name := range []string{t.keys.hashKey, t.keys.rangeKey, keys.hashKey, keys.rangeKey} {
+		if name != "" {
+			key[name] = it[name]
+		}
+	}
+	return copyItem(key)
+}
+
+// keyOf validates the primary key attributes of a key or item and returns its storage identifier. When exact is
+// true the map must contain only the key attributes, as DynamoDB requires for GetItem, UpdateItem and DeleteItem.
+func (t *memTable) keyOf(key item, exact bool) (string, error) {
+	names := []string{t.keys.hashKey}
+	if t.keys.rangeKey != "" {
+		names = append(names, t.keys.rangeKey)
+	}
+
+	if exact && len(key) != len(names) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value, ok := key[name]
+		if !ok {
+			return "", validationError(fmt.Sprintf("One of the required keys was not given a value: missing key %s", name))
+		}
+		encoded := encodeKeyValue(value)
+		if encoded == "" {
+			return "", validationError(fmt.Sprintf("The provided key element %s must be a non empty string, number or binary", name))
+		}
+		parts = append(parts, encoded)
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+func copyItem(it item) item {
+	if it == nil {
+		return nil
+	}
+	out := make(item, len(it))
+	for k, v := range it {
+		out[k] = copyAttributeValue(v)
+	}
+	return out
+}
+
+func copyAttributeValue(value types.AttributeValue) types.AttributeValue {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte{}, v.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberBS:
+		out := make([][]byte, 0, len(v.Value))
+		for _, b := range v.Value {
+			out = append(out, append([]byte{}, b...))
+		}
+		return &types.AttributeValueMemberBS{Value: out}
+	case *types.AttributeValueMemberL:
+		out := make([]types.AttributeValue, 0, len(v.Value))
+		for _, e := range v.Value {
+			out = append(out, copyAttributeValue(e))
+		}
+		return &types.AttributeValueMemberL{Value: out}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: copyItem(v.Value)}
+	}
+	return value
+}
+
+func validationError(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
@@ -0,0 +1,1073 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// item is the in-memory representation of a DynamoDB item.
+type item = map[string]types.AttributeValue
+
+// condition evaluates a parsed condition, filter or key condition expression against an item.
+type condition func(it item) (bool, error)
+
+// operand resolves a path, placeholder or function to a value. found is false when a path does not exist on the item.
+type operand func(it item) (value types.AttributeValue, found bool, err error)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName
+	tokenValue
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':':
+			start := i
+			i++
+			for i < len(runes) && isWord(runes[i]) {
+				i++
+			}
+			kind := tokenName
+			if r == ':' {
+				kind = tokenValue
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i])})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i])})
+		case isWord(r):
+			start := i
+			for i < len(runes) && isWord(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i])})
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, token{kind: tokenPunct, text: string(runes[i : i+2])})
+				i += 2
+			} else {
+				tokens = append(tokens, token{kind: tokenPunct, text: string(r)})
+				i++
+			}
+		case strings.ContainsRune("()[],.=+-", r):
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid character [%c] in expression [%s]", r, expression)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type expressionParser struct {
+	expression string
+	tokens     []token
+	pos        int
+	names      map[string]string
+	values     map[string]types.AttributeValue
+}
+
+func newExpressionParser(expression string, names map[string]string, values map[string]types.AttributeValue) (*expressionParser, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	return &expressionParser{expression: expression, tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *expressionParser) peek() token { return p.tokens[p.pos] }
+
+func (p *expressionParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *expressionParser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *expressionParser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == text
+}
+
+func (p *expressionParser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		return p.errorf("expected [%s] but found [%s]", text, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *expressionParser) expectEOF() error {
+	if p.peek().kind != tokenEOF {
+		return p.errorf("unexpected token [%s]", p.peek().text)
+	}
+	return nil
+}
+
+func (p *expressionParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid expression [%s]: %s", p.expression, fmt.Sprintf(format, args...))
+}
+
+// parseCondition parses a complete ConditionExpression, FilterExpression or KeyConditionExpression.
+func parseCondition(expression string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	if len(strings.TrimSpace(expression)) == 0 {
+		return func(item) (bool, error) { return true, nil }, nil
+	}
+
+	p, err := newExpressionParser(expression, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.expectEOF()
+}
+
+func (p *expressionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(it item) (bool, error) {
+			ok, err := l(it)
+			if err != nil || !ok {
+				return ok, err
+			}
+			return right(it)
+		}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseNot() (condition, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			ok, err := c(it)
+			return !ok, err
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (condition, error) {
+	if p.isPunct("(") {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expectPunct(")")
+	}
+
+	if t := p.peek(); t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			return p.parseConditionFunction()
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isKeyword("BETWEEN"):
+		p.next()
+		lower, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, p.errorf("expected AND in BETWEEN")
+		}
+		p.next()
+		upper, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			ge, err := compareOperands(it, left, lower, ">=")
+			if err != nil || !ge {
+				return ge, err
+			}
+			return compareOperands(it, left, upper, "<=")
+		}, nil
+	case p.isKeyword("IN"):
+		p.next()
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		var candidates []operand
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, o)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (bool, error) {
+			for _, candidate := range candidates {
+				ok, err := compareOperands(it, left, candidate, "=")
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}, nil
+	}
+
+	t := p.next()
+	switch t.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, p.errorf("expected comparator but found [%s]", t.text)
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (bool, error) {
+		return compareOperands(it, left, right, t.text)
+	}, nil
+}
+
+func (p *expressionParser) parseConditionFunction() (condition, error) {
+	name := strings.ToLower(p.next().text)
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+
+	var argument operand
+	if name != "attribute_exists" && name != "attribute_not_exists" {
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		if argument, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+
+	return func(it item) (bool, error) {
+		value, found := resolvePath(it, path)
+		switch name {
+		case "attribute_exists":
+			return found, nil
+		case "attribute_not_exists":
+			return !found, nil
+		}
+
+		arg, argFound, err := argument(it)
+		if err != nil || !found || !argFound {
+			return false, err
+		}
+
+		switch name {
+		case "attribute_type":
+			s, ok := arg.(*types.AttributeValueMemberS)
+			return ok && attributeTypeCode(value) == s.Value, nil
+		case "begins_with":
+			switch v := value.(type) {
+			case *types.AttributeValueMemberS:
+				prefix, ok := arg.(*types.AttributeValueMemberS)
+				return ok && strings.HasPrefix(v.Value, prefix.Value), nil
+			case *types.AttributeValueMemberB:
+				prefix, ok := arg.(*types.AttributeValueMemberB)
+				return ok && bytes.HasPrefix(v.Value, prefix.Value), nil
+			}
+			return false, nil
+		default:
+			return containsValue(value, arg), nil
+		}
+	}, nil
+}
+
+func (p *expressionParser) parseOperand() (operand, error) {
+	t := p.peek()
+
+	if t.kind == tokenValue {
+		p.next()
+		value, ok := p.values[t.text]
+		if !ok {
+			return nil, p.errorf("value placeholder [%s] is not defined in ExpressionAttributeValues", t.text)
+		}
+		return func(item) (types.AttributeValue, bool, error) { return value, true, nil }, nil
+	}
+
+	if t.kind == tokenIdent && strings.EqualFold(t.text, "size") && p.tokens[p.pos+1].text == "(" {
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			value, found := resolvePath(it, path)
+			if !found {
+				return nil, false, nil
+			}
+			size, ok := attributeSize(value)
+			if !ok {
+				return nil, false, nil
+			}
+			return &types.AttributeValueMemberN{Value: strconv.Itoa(size)}, true, nil
+		}, nil
+	}
+
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (types.AttributeValue, bool, error) {
+		value, found := resolvePath(it, path)
+		return value, found, nil
+	}, nil
+}
+
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+func (p *expressionParser) parsePath() ([]pathElement, error) {
+	var path []pathElement
+
+	name, err := p.parsePathName()
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, pathElement{name: name})
+
+	for {
+		switch {
+		case p.isPunct("."):
+			p.next()
+			name, err := p.parsePathName()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{name: name})
+		case p.isPunct("["):
+			p.next()
+			t := p.next()
+			if t.kind != tokenNumber {
+				return nil, p.errorf("expected list index but found [%s]", t.text)
+			}
+			index, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, p.errorf("invalid list index [%s]", t.text)
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElement{index: index, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *expressionParser) parsePathName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return t.text, nil
+	case tokenName:
+		name, ok := p.names[t.text]
+		if !ok {
+			return "", p.errorf("name placeholder [%s] is not defined in ExpressionAttributeNames", t.text)
+		}
+		return name, nil
+	default:
+		return "", p.errorf("expected attribute name but found [%s]", t.text)
+	}
+}
+
+// updateAction applies one clause of an update expression to the item. The operands are resolved against
+// the original item, matching DynamoDB which evaluates every right hand side before applying any change.
+type updateAction struct {
+	path  []pathElement
+	apply func(original item, updated item) error
+}
+
+// parseUpdate parses the SET, REMOVE, ADD and DELETE clauses of an UpdateExpression.
+func parseUpdate(expression string, names map[string]string, values map[string]types.AttributeValue) ([]updateAction, error) {
+	p, err := newExpressionParser(expression, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []updateAction
+	for p.peek().kind != tokenEOF {
+		clause := p.next()
+		if clause.kind != tokenIdent {
+			return nil, p.errorf("expected SET, REMOVE, ADD or DELETE but found [%s]", clause.text)
+		}
+
+		for {
+			action, err := p.parseUpdateAction(strings.ToUpper(clause.text))
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, action)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if len(actions) == 0 {
+		return nil, p.errorf("update expression is empty")
+	}
+	return actions, nil
+}
+
+func (p *expressionParser) parseUpdateAction(clause string) (updateAction, error) {
+	path, err := p.parsePath()
+	if err != nil {
+		return updateAction{}, err
+	}
+
+	switch clause {
+	case "SET":
+		if err := p.expectPunct("="); err != nil {
+			return updateAction{}, err
+		}
+		value, err := p.parseSetValue()
+		if err != nil {
+			return updateAction{}, err
+		}
+		return updateAction{path: path, apply: func(original item, updated item) error {
+			v, found, err := value(original)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("the provided expression refers to an attribute that does not exist in the item")
+			}
+			return setPath(updated, path, v)
+		}}, nil
+	case "REMOVE":
+		return updateAction{path: path, apply: func(_ item, updated item) error {
+			removePath(updated, path)
+			return nil
+		}}, nil
+	case "ADD", "DELETE":
+		value, err := p.parseOperand()
+		if err != nil {
+			return updateAction{}, err
+		}
+		return updateAction{path: path, apply: func(original item, updated item) error {
+			v, _, err := value(original)
+			if err != nil {
+				return err
+			}
+			current, found := resolvePath(original, path)
+			var result types.AttributeValue
+			if clause == "ADD" {
+				result, err = addValues(current, found, v)
+			} else {
+				result, err = deleteFromSet(current, found, v)
+			}
+			if err != nil {
+				return err
+			}
+			if result == nil {
+				removePath(updated, path)
+				return nil
+			}
+			return setPath(updated, path, result)
+		}}, nil
+	default:
+		return updateAction{}, p.errorf("unsupported update clause [%s]", clause)
+	}
+}
+
+func (p *expressionParser) parseSetValue() (operand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isPunct("+") && !p.isPunct("-") {
+		return left, nil
+	}
+
+	sign := p.next().text
+	right, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(it item) (types.AttributeValue, bool, error) {
+		l, lFound, err := left(it)
+		if err != nil || !lFound {
+			return nil, false, err
+		}
+		r, rFound, err := right(it)
+		if err != nil || !rFound {
+			return nil, false, err
+		}
+		result, err := arithmetic(l, r, sign)
+		return result, err == nil, err
+	}, nil
+}
+
+func (p *expressionParser) parseSetOperand() (operand, error) {
+	t := p.peek()
+	if t.kind != tokenIdent || p.tokens[p.pos+1].text != "(" {
+		return p.parseOperand()
+	}
+
+	switch strings.ToLower(t.text) {
+	case "if_not_exists":
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			if value, found := resolvePath(it, path); found {
+				return value, true, nil
+			}
+			return fallback(it)
+		}, nil
+	case "list_append":
+		p.next()
+		p.next()
+		first, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		second, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return func(it item) (types.AttributeValue, bool, error) {
+			a, aFound, err := first(it)
+			if err != nil || !aFound {
+				return nil, false, err
+			}
+			b, bFound, err := second(it)
+			if err != nil || !bFound {
+				return nil, false, err
+			}
+			la, aOk := a.(*types.AttributeValueMemberL)
+			lb, bOk := b.(*types.AttributeValueMemberL)
+			if !aOk || !bOk {
+				return nil, false, fmt.Errorf("list_append requires two list operands")
+			}
+			joined := append(append([]types.AttributeValue{}, la.Value...), lb.Value...)
+			return &types.AttributeValueMemberL{Value: joined}, true, nil
+		}, nil
+	default:
+		return p.parseOperand()
+	}
+}
+
+func resolvePath(it item, path []pathElement) (types.AttributeValue, bool) {
+	value, found := it[path[0].name]
+	for _, element := range path[1:] {
+		if !found {
+			return nil, false
+		}
+		switch v := value.(type) {
+		case *types.AttributeValueMemberM:
+			if element.isIndex {
+				return nil, false
+			}
+			value, found = v.Value[element.name]
+		case *types.AttributeValueMemberL:
+			if !element.isIndex || element.index >= len(v.Value) {
+				return nil, false
+			}
+			value = v.Value[element.index]
+		default:
+			return nil, false
+		}
+	}
+	return value, found
+}
+
+func setPath(it item, path []pathElement, value types.AttributeValue) error {
+	if len(path) == 1 {
+		it[path[0].name] = value
+		return nil
+	}
+
+	parent, found := resolvePath(it, path[:len(path)-1])
+	if !found {
+		return fmt.Errorf("the document path provided in the update expression is invalid for update")
+	}
+
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if last.isIndex {
+			return fmt.Errorf("cannot index into a map with [%d]", last.index)
+		}
+		v.Value[last.name] = value
+	case *types.AttributeValueMemberL:
+		if !last.isIndex {
+			return fmt.Errorf("cannot set attribute [%s] on a list", last.name)
+		}
+		if last.index < len(v.Value) {
+			v.Value[last.index] = value
+		} else {
+			v.Value = append(v.Value, value)
+		}
+	default:
+		return fmt.Errorf("the document path provided in the update expression is invalid for update")
+	}
+	return nil
+}
+
+func removePath(it item, path []pathElement) {
+	if len(path) == 1 {
+		delete(it, path[0].name)
+		return
+	}
+
+	parent, found := resolvePath(it, path[:len(path)-1])
+	if !found {
+		return
+	}
+
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case *types.AttributeValueMemberM:
+		delete(v.Value, last.name)
+	case *types.AttributeValueMemberL:
+		if last.isIndex && last.index < len(v.Value) {
+			v.Value = append(v.Value[:last.index], v.Value[last.index+1:]...)
+		}
+	}
+}
+
+func compareOperands(it item, left, right operand, comparator string) (bool, error) {
+	l, lFound, err := left(it)
+	if err != nil {
+		return false, err
+	}
+	r, rFound, err := right(it)
+	if err != nil {
+		return false, err
+	}
+
+	if !lFound || !rFound {
+		return comparator == "<>", nil
+	}
+
+	switch comparator {
+	case "=":
+		return attributeValuesEqual(l, r), nil
+	case "<>":
+		return !attributeValuesEqual(l, r), nil
+	}
+
+	cmp, ok := compareAttributeValues(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch comparator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// compareAttributeValues orders two scalar values of the same type. ok is false when they cannot be ordered.
+func compareAttributeValues(a, b types.AttributeValue) (int, bool) {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av.Value, bv.Value), true
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		x, xOk := new(big.Rat).SetString(av.Value)
+		y, yOk := new(big.Rat).SetString(bv.Value)
+		if !xOk || !yOk {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case *types.AttributeValueMemberB:
+		bv, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(av.Value, bv.Value), true
+	}
+	return 0, false
+}
+
+func attributeValuesEqual(a, b types.AttributeValue) bool {
+	if cmp, ok := compareAttributeValues(a, b); ok {
+		return cmp == 0
+	}
+
+	switch av := a.(type) {
+	case *types.AttributeValueMemberBOOL:
+		bv, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberNULL:
+		_, ok := b.(*types.AttributeValueMemberNULL)
+		return ok
+	case *types.AttributeValueMemberSS:
+		bv, ok := b.(*types.AttributeValueMemberSS)
+		return ok && sameStringSet(av.Value, bv.Value)
+	case *types.AttributeValueMemberNS:
+		bv, ok := b.(*types.AttributeValueMemberNS)
+		return ok && sameStringSet(normaliseNumbers(av.Value), normaliseNumbers(bv.Value))
+	case *types.AttributeValueMemberL:
+		bv, ok := b.(*types.AttributeValueMemberL)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for i := range av.Value {
+			if !attributeValuesEqual(av.Value[i], bv.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		bv, ok := b.(*types.AttributeValueMemberM)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for k, v := range av.Value {
+			other, found := bv.Value[k]
+			if !found || !attributeValuesEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string{}, a...)
+	y := append([]string{}, b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func normaliseNumbers(numbers []string) []string {
+	out := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		if r, ok := new(big.Rat).SetString(n); ok {
+			out = append(out, r.RatString())
+		} else {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func containsValue(container, value types.AttributeValue) bool {
+	switch c := container.(type) {
+	case *types.AttributeValueMemberS:
+		s, ok := value.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(c.Value, s.Value)
+	case *types.AttributeValueMemberSS:
+		s, ok := value.(*types.AttributeValueMemberS)
+		return ok && contains(c.Value, s.Value)
+	case *types.AttributeValueMemberNS:
+		n, ok := value.(*types.AttributeValueMemberN)
+		return ok && contains(normaliseNumbers(c.Value), normaliseNumbers([]string{n.Value})[0])
+	case *types.AttributeValueMemberL:
+		for _, v := range c.Value {
+			if attributeValuesEqual(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func attributeTypeCode(value types.AttributeValue) string {
+	switch value.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+	return ""
+}
+
+func attributeSize(value types.AttributeValue) (int, bool) {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberB:
+		return len(v.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberL:
+		return len(v.Value), true
+	case *types.AttributeValueMemberM:
+		return len(v.Value), true
+	}
+	return 0, false
+}
+
+func arithmetic(a, b types.AttributeValue, sign string) (types.AttributeValue, error) {
+	an, aOk := a.(*types.AttributeValueMemberN)
+	bn, bOk := b.(*types.AttributeValueMemberN)
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+	}
+
+	x, xOk := new(big.Rat).SetString(an.Value)
+	y, yOk := new(big.Rat).SetString(bn.Value)
+	if !xOk || !yOk {
+		return nil, fmt.Errorf("invalid numbers [%s] and [%s]", an.Value, bn.Value)
+	}
+
+	if sign == "-" {
+		y.Neg(y)
+	}
+	return &types.AttributeValueMemberN{Value: formatNumber(x.Add(x, y))}, nil
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(38), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func addValues(current types.AttributeValue, found bool, value types.AttributeValue) (types.AttributeValue, error) {
+	if !found {
+		return value, nil
+	}
+
+	switch c := current.(type) {
+	case *types.AttributeValueMemberN:
+		return arithmetic(c, value, "+")
+	case *types.AttributeValueMemberSS:
+		v, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		out := append([]string{}, c.Value...)
+		for _, s := range v.Value {
+			if !contains(out, s) {
+				out = append(out, s)
+			}
+		}
+		return &types.AttributeValueMemberSS{Value: out}, nil
+	case *types.AttributeValueMemberNS:
+		v, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		out := append([]string{}, c.Value...)
+		for _, s := range v.Value {
+			if !contains(normaliseNumbers(out), normaliseNumbers([]string{s})[0]) {
+				out = append(out, s)
+			}
+		}
+		return &types.AttributeValueMemberNS{Value: out}, nil
+	}
+	return nil, fmt.Errorf("ADD is only supported for numbers and sets")
+}
+
+func deleteFromSet(current types.AttributeValue, found bool, value types.AttributeValue) (types.AttributeValue, error) {
+	if !found {
+		return nil, nil
+	}
+
+	var remaining []string
+	switch c := current.(type) {
+	case *types.AttributeValueMemberSS:
+		v, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		for _, s := range c.Value {
+			if !contains(v.Value, s) {
+				remaining = append(remaining, s)
+			}
+		}
+		if len(remaining) > 0 {
+			return &types.AttributeValueMemberSS{Value: remaining}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		v, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return nil, fmt.Errorf("an operand in the update expression has an incorrect data type")
+		}
+		deleted := normaliseNumbers(v.Value)
+		for _, s := range c.Value {
+			if !contains(deleted, normaliseNumbers([]string{s})[0]) {
+				remaining = append(remaining, s)
+			}
+		}
+		if len(remaining) > 0 {
+			return &types.AttributeValueMemberNS{Value: remaining}, nil
+		}
+	default:
+		return nil, fmt.Errorf("DELETE is only supported for sets")
+	}
+	return nil, nil
+}
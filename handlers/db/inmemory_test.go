@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTable = "test-table"
+
+func attrS(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+func attrN(v int64) types.AttributeValue  { return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)} }
+
+func newTestInMemoryDynamoDB(now time.Time) *InMemoryDynamoDB {
+	client := NewInMemoryDynamoDB(util.NewFixedClock(now))
+	client.CreatePkSkTable(testTable, "ttl")
+	return client
+}
+
+func TestInMemoryDynamoDB_ConditionalPut(t *testing.T) {
+	ctx := context.TODO()
+	client := newTestInMemoryDynamoDB(time.Now())
+
+	put := &dynamodb.PutItemInput{
+		TableName:           aws.String(testTable),
+		Item:                map[string]types.AttributeValue{"pk": attrS("A"), "sk": attrS("A")},
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	}
+
+	_, err := client.PutItem(ctx, put)
+	require.NoError(t, err)
+
+	_, err = client.PutItem(ctx, put)
+	var conditionFailed *types.ConditionalCheckFailedException
+	assert.True(t, errors.As(err, &conditionFailed))
+}
+
+func TestInMemoryDynamoDB_KeysMustMatchSchema(t *testing.T) {
+	ctx := context.TODO()
+	client := newTestInMemoryDynamoDB(time.Now())
+
+	_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(testTable),
+		Key:       map[string]types.AttributeValue{"id": attrS("A")},
+	})
+	assert.Error(t, err)
+
+	_, err = client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("missing-table"),
+		Key:       map[string]types.AttributeValue{"pk": attrS("A"), "sk": attrS("A")},
+	})
+	var notFound *types.ResourceNotFoundException
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestInMemoryDynamoDB_TransactionIsAllOrNothing(t *testing.T) {
+	ctx := context.TODO()
+	client := newTestInMemoryDynamoDB(time.Now())
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(testTable),
+		Item:      map[string]types.AttributeValue{"pk": attrS("EXISTING"), "sk": attrS("EXISTING")},
+	})
+	require.NoError(t, err)
+
+	_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{
+				TableName:           aws.String(testTable),
+				Item:                map[string]types.AttributeValue{"pk": attrS("NEW"), "sk": attrS("NEW")},
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+			{Put: &types.Put{
+				TableName:           aws.String(testTable),
+				Item:                map[string]types.AttributeValue{"pk": attrS("EXISTING"), "sk": attrS("EXISTING")},
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+		},
+	})
+
+	var cancelled *types.TransactionCanceledException
+	require.True(t, errors.As(err, &cancelled))
+	assert.Equal(t, "None", aws.ToString(cancelled.CancellationReasons[0].Code))
+	assert.Equal(t, "ConditionalCheckFailed", aws.ToString(cancelled.CancellationReasons[1].Code))
+
+	got, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(testTable),
+		Key:       map[string]types.AttributeValue{"pk": attrS("NEW"), "sk": attrS("NEW")},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, got.Item, "no write from a cancelled transaction should be applied")
+}
+
+func TestInMemoryDynamoDB_ExpiredItems(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := newTestInMemoryDynamoDB(now)
+
+	for pk, ttl := range map[string]int64{"EXPIRED": now.Unix() - 1, "LIVE": now.Unix() + 1} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(testTable),
+			Item:      map[string]types.AttributeValue{"pk": attrS(pk), "sk": attrS(pk), "ttl": attrN(ttl)},
+		})
+		require.NoError(t, err)
+	}
+	getExpired := &dynamodb.GetItemInput{
+		TableName: aws.String(testTable),
+		Key:       map[string]types.AttributeValue{"pk": attrS("EXPIRED"), "sk": attrS("EXPIRED")},
+	}
+
+	expired, err := client.GetItem(ctx, getExpired)
+	require.NoError(t, err)
+	assert.NotNil(t, expired.Item, "like DynamoDB, expired items are served until they are deleted")
+
+	client.ExpireItems = true
+	expired, err = client.GetItem(ctx, getExpired)
+	require.NoError(t, err)
+	assert.Nil(t, expired.Item)
+
+	scan, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(testTable)})
+	require.NoError(t, err)
+	require.Len(t, scan.Items, 1)
+	assert.Equal(t, attrS("LIVE"), scan.Items[0]["pk"])
+}
+
+func TestInMemoryDynamoDB_UpdateExpression(t *testing.T) {
+	ctx := context.TODO()
+	client := newTestInMemoryDynamoDB(time.Now())
+	key := map[string]types.AttributeValue{"pk": attrS("A"), "sk": attrS("A")}
+
+	_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(testTable),
+		Item:      map[string]types.AttributeValue{"pk": attrS("A"), "sk": attrS("A"), "version": attrN(1), "old": attrS("x")},
+	})
+	require.NoError(t, err)
+
+	update := &dynamodb.UpdateItemInput{
+		TableName:                aws.String(testTable),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET #name = :name, version = version + :one REMOVE old"),
+		ConditionExpression:      aws.String("version = :expected"),
+		ExpressionAttributeNames: map[string]string{"#name": "name"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":name":     attrS("updated"),
+			":one":      attrN(1),
+			":expected": attrN(1),
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	}
+
+	out, err := client.UpdateItem(ctx, update)
+	require.NoError(t, err)
+	assert.Equal(t, attrS("updated"), out.Attributes["name"])
+	assert.Equal(t, attrN(2), out.Attributes["version"])
+	assert.NotContains(t, out.Attributes, "old")
+
+	_, err = client.UpdateItem(ctx, update)
+	var conditionFailed *types.ConditionalCheckFailedException
+	assert.True(t, errors.As(err, &conditionFailed), "stale version should fail the condition")
+}
+
+func TestInMemoryDynamoDB_QueryPagesThroughSortKeys(t *testing.T) {
+	ctx := context.TODO()
+	client := newTestInMemoryDynamoDB(time.Now())
+
+	for _, sk := range []string{"C", "A", "B"} {
+		_, err := client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(testTable),
+			Item:      map[string]types.AttributeValue{"pk": attrS("P"), "sk": attrS(sk)},
+		})
+		require.NoError(t, err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(testTable),
+		KeyConditionExpression:    aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": attrS("P"), ":prefix": attrS("")},
+		Limit:                     aws.Int32(2),
+	}
+
+	first, err := client.Query(ctx, input)
+	require.NoError(t, err)
+	require.Len(t, first.Items, 2)
+	assert.Equal(t, attrS("A"), first.Items[0]["sk"])
+	assert.Equal(t, attrS("B"), first.Items[1]["sk"])
+	require.NotNil(t, first.LastEvaluatedKey)
+
+	input.ExclusiveStartKey = first.LastEvaluatedKey
+	second, err := client.Query(ctx, input)
+	require.NoError(t, err)
+	require.Len(t, second.Items, 1)
+	assert.Equal(t, attrS("C"), second.Items[0]["sk"])
+}
@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// janitorWorkers bounds the number of deletes Sweep runs at once.
+const janitorWorkers = 8
+
+// Janitor deletes test data that DynamoDB has not removed. TTL is not enforced by DynamoDB Local and is applied up
+// to 48 hours late in AWS, and an email uniqueness item can outlive its user if the user was removed by hand.
+// Email items written before they recorded their userId are matched to users by email instead, so the janitor
+// holds the email of every user in the table while it sweeps.
+type Janitor struct {
+	ddb   Repository
+	clock util.Clock
+}
+
+// NewJanitor creates a Janitor for one table. Expiry is judged by clock rather than by DynamoDB.
+func NewJanitor(repository Repository, clock util.Clock) *Janitor {
+	return &Janitor{
+		ddb:   repository,
+		clock: clock,
+	}
+}
+
+// SweepReason is why Sweep deletes an item.
+type SweepReason string
+
+const (
+	SweepExpired SweepReason = "EXPIRED"
+	SweepOrphan  SweepReason = "ORPHAN"
+)
+
+// SweptItem is an item Sweep deleted, or would delete in a dry run.
+type SweptItem struct {
+	Pk     string      `json:"pk"`
+	Sk     string      `json:"sk"`
+	Reason SweepReason `json:"reason"`
+}
+
+// SweepReport counts what Sweep found in a table. Skipped items changed between being scanned and being deleted,
+// such as a user whose ttl was extended, and were left alone.
+type SweepReport struct {
+	Table    string      `json:"table"`
+	DryRun   bool        `json:"dryRun"`
+	Scanned  int         `json:"scanned"`
+	Expired  int         `json:"expired"`
+	Orphaned int         `json:"orphaned"`
+	Deleted  int         `json:"deleted"`
+	Skipped  int         `json:"skipped"`
+	Items    []SweptItem `json:"items"`
+}
+
+// sweepEntity is the part of any item Sweep needs. UserId is only set on email uniqueness items, and Email only on
+// users.
+type sweepEntity struct {
+	Pk       string `dynamodbav:"pk"`
+	Sk       string `dynamodbav:"sk"`
+	ExpireAt int64  `dynamodbav:"ttl"`
+	UserId   string `dynamodbav:"userId"`
+	Email    string `dynamodbav:"email"`
+}
+
+type sweepCandidate struct {
+	entity sweepEntity
+	reason SweepReason
+}
+
+// Sweep scans the table and deletes items whose ttl has passed and email uniqueness items whose user does not
+// exist. An email item without a userId is only deleted once the whole table has been scanned without finding a
+// user with its email. Every delete is conditional on the item being unchanged since it was scanned. A dry run
+// reports the items without deleting them.
+func (j *Janitor) Sweep(ctx context.Context, dryRun bool) (SweepReport, error) {
+	logger := zerolog.Ctx(ctx)
+	pages := j.ddb.ScanPages(&dynamodb.ScanInput{
+		ProjectionExpression:     aws.String("pk, sk, #ttl, userId, email"),
+		ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+	})
+
+	report := SweepReport{Table: j.ddb.GetTablename(), DryRun: dryRun, Items: []SweptItem{}}
+	owned := map[string]bool{}
+	var unowned []sweepEntity
+	for pages.HasMorePages() {
+		var entities []sweepEntity
+		if err := pages.NextPage(ctx, &entities); err != nil {
+			logger.Err(err).Str("table", report.Table).Msg("Failed to scan table")
+			return report, err
+		}
+		report.Scanned += len(entities)
+
+		candidates, err := j.candidates(ctx, entities, owned, &unowned)
+		if err != nil {
+			return report, err
+		}
+		if err := j.remove(ctx, &report, candidates); err != nil {
+			return report, err
+		}
+	}
+
+	var orphans []sweepCandidate
+	for _, email := range unowned {
+		if !owned[strings.TrimPrefix(email.Pk, pk("USEREMAIL", ""))] {
+			orphans = append(orphans, sweepCandidate{entity: email, reason: SweepOrphan})
+		}
+	}
+	if err := j.remove(ctx, &report, orphans); err != nil {
+		return report, err
+	}
+
+	logger.Info().Str("table", report.Table).Bool("dryRun", dryRun).Int("scanned", report.Scanned).
+		Int("expired", report.Expired).Int("orphaned", report.Orphaned).Int("deleted", report.Deleted).
+		Int("skipped", report.Skipped).Msg("swept table")
+	return report, nil
+}
+
+// remove deletes the candidates, or only reports them in a dry run, adding what it did to report.
+func (j *Janitor) remove(ctx context.Context, report *SweepReport, candidates []sweepCandidate) error {
+	for _, candidate := range candidates {
+		if candidate.reason == SweepExpired {
+			report.Expired++
+		} else {
+			report.Orphaned++
+		}
+	}
+
+	if report.DryRun {
+		for _, candidate := range candidates {
+			report.Items = append(report.Items, sweptItem(candidate))
+		}
+		report.Deleted += len(candidates)
+		return nil
+	}
+
+	var mu sync.Mutex
+	errs := make([]error, len(candidates))
+	forEachChunk(len(candidates), janitorWorkers, func(i int) {
+		err := j.delete(ctx, candidates[i])
+		mu.Lock()
+		defer mu.Unlock()
+		if errors.Is(err, ErrConditionFailed) {
+			report.Skipped++
+			return
+		}
+		errs[i] = err
+		if err == nil {
+			report.Deleted++
+			report.Items = append(report.Items, sweptItem(candidates[i]))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("table", report.Table).Msg("Failed to delete test data")
+		return err
+	}
+	return nil
+}
+
+// candidates picks the items of a page to delete, reading the users of the page's email items in one batch. The
+// emails of the page's users are added to owned, and email items with no userId to unowned, as the user owning
+// one of those can be on any page.
+func (j *Janitor) candidates(ctx context.Context, entities []sweepEntity, owned map[string]bool, unowned *[]sweepEntity) ([]sweepCandidate, error) {
+	now := j.clock.Now().Unix()
+
+	var candidates []sweepCandidate
+	var emails []sweepEntity
+	var userKeys []map[string]types.AttributeValue
+	for _, entity := range entities {
+		if strings.HasPrefix(entity.Pk, pk("USERNAME", "")) && len(entity.Email) > 0 {
+			owned[NormaliseEmail(entity.Email)] = true
+		}
+		switch {
+		case entity.ExpireAt > 0 && entity.ExpireAt <= now:
+			candidates = append(candidates, sweepCandidate{entity: entity, reason: SweepExpired})
+		case strings.HasPrefix(entity.Pk, pk("USEREMAIL", "")) && len(entity.UserId) == 0:
+			*unowned = append(*unowned, entity)
+		case strings.HasPrefix(entity.Pk, pk("USEREMAIL", "")):
+			emails = append(emails, entity)
+			userKeys = append(userKeys, PkSkKey("USERNAME")(entity.UserId))
+		}
+	}
+	if len(emails) == 0 {
+		return candidates, nil
+	}
+
+	var users []sweepEntity
+	if err := j.ddb.BatchGet(ctx, userKeys, &users); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to read the users of email items")
+		return nil, err
+	}
+	exists := make(map[string]bool, len(users))
+	for _, user := range users {
+		exists[user.Pk] = true
+	}
+	for _, email := range emails {
+		if !exists[usernamePK(email.UserId)] {
+			candidates = append(candidates, sweepCandidate{entity: email, reason: SweepOrphan})
+		}
+	}
+	return candidates, nil
+}
+
+func (j *Janitor) delete(ctx context.Context, candidate sweepCandidate) error {
+	entity := candidate.entity
+	remove := &types.Delete{
+		TableName: aws.String(j.ddb.GetTablename()),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: entity.Pk},
+			"sk": &types.AttributeValueMemberS{Value: entity.Sk},
+		},
+	}
+
+	switch {
+	case candidate.reason == SweepExpired:
+		remove.ConditionExpression = aws.String("#ttl = :ttl")
+		remove.ExpressionAttributeNames = map[string]string{"#ttl": "ttl"}
+		remove.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(entity.ExpireAt, 10)},
+		}
+	case len(entity.UserId) == 0:
+		// no user had its email when the table was scanned, and none can be given it while the item exists
+		remove.ConditionExpression = aws.String("attribute_exists(pk) AND attribute_not_exists(userId)")
+	default:
+		remove.ConditionExpression = aws.String("userId = :userId")
+		remove.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":userId": &types.AttributeValueMemberS{Value: entity.UserId},
+		}
+		// the user may have been created since the page was scanned, in which case the email is not an orphan
+		return j.ddb.TransactPut(ctx, []types.TransactWriteItem{
+			{Delete: remove},
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName:           aws.String(j.ddb.GetTablename()),
+					Key:                 PkSkKey("USERNAME")(entity.UserId),
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+		})
+	}
+
+	return j.ddb.TransactPut(ctx, []types.TransactWriteItem{{Delete: remove}})
+}
+
+func sweptItem(candidate sweepCandidate) SweptItem {
+	return SweptItem{Pk: candidate.entity.Pk, Sk: candidate.entity.Sk, Reason: candidate.reason}
+}
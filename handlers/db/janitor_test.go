@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTableWithoutTTL is an in-memory users table that, like DynamoDB Local, never expires items itself.
+func newTestTableWithoutTTL(clock util.Clock) *DynamoRepository {
+	client := NewInMemoryDynamoDB(clock)
+	client.CreatePkSkTable("cmyk-users", "")
+	table := NewInstanceWithClient(client, "cmyk-users")
+	return &table
+}
+
+func TestJanitorSweep(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	table := newTestTableWithoutTTL(clock)
+	users := NewUsersRepo(table, clock)
+
+	expired, err := users.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())), model.Ephemeral)
+	require.NoError(t, err)
+	lasting, err := users.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())), model.Long)
+	require.NoError(t, err)
+	permanent, err := users.AddUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())))
+	require.NoError(t, err)
+
+	// a user removed by hand leaves its email behind
+	removed, err := users.AddUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())))
+	require.NoError(t, err)
+	require.NoError(t, table.Delete(ctx, users.users.Key(removed.Id)))
+
+	clock.Advance(2 * time.Hour)
+	janitor := NewJanitor(table, clock)
+
+	report, err := janitor.Sweep(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 7, report.Scanned)
+	assert.Equal(t, 2, report.Expired, "the expired user and its email")
+	assert.Equal(t, 1, report.Orphaned)
+	assert.Equal(t, 3, report.Deleted)
+	assert.ElementsMatch(t, []SweptItem{
+		{Pk: usernamePK(expired.Id), Sk: usernamePK(expired.Id), Reason: SweepExpired},
+		{Pk: emailPk(expired.Email), Sk: emailPk(expired.Email), Reason: SweepExpired},
+		{Pk: emailPk(removed.Email), Sk: emailPk(removed.Email), Reason: SweepOrphan},
+	}, report.Items)
+
+	_, err = users.GetUserByID(ctx, expired.Id)
+	require.NoError(t, err, "a dry run must not delete anything")
+
+	report, err = janitor.Sweep(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Deleted)
+	assert.Zero(t, report.Skipped)
+
+	_, err = users.GetUserByID(ctx, expired.Id)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = users.GetUserByEmail(ctx, expired.Email)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	for _, kept := range []*model.User{lasting, permanent} {
+		_, err = users.GetUserByEmail(ctx, kept.Email)
+		assert.NoError(t, err)
+	}
+
+	// the orphaned email can be registered again
+	_, err = users.AddUser(ctx, util.RandomTestUser(util.WithEmail(removed.Email), util.WithCreatedAt(clock.Now())))
+	assert.NoError(t, err)
+
+	report, err = janitor.Sweep(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, report.Deleted, "a second sweep finds nothing")
+}
+
+func TestJanitorSweep_EmailsWithoutUserId(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	table := newTestTableWithoutTTL(clock)
+	users := NewUsersRepo(table, clock)
+
+	// email items written before they recorded their user have only a key
+	type legacyEmailEntity struct {
+		Pk string `dynamodbav:"pk"`
+		Sk string `dynamodbav:"sk"`
+	}
+	owned, err := users.AddUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())))
+	require.NoError(t, err)
+	require.NoError(t, table.Put(ctx, legacyEmailEntity{Pk: emailPk(owned.Email), Sk: emailPk(owned.Email)}))
+	abandoned := "Abandoned@Example.com"
+	require.NoError(t, table.Put(ctx, legacyEmailEntity{Pk: emailPk(abandoned), Sk: emailPk(abandoned)}))
+
+	report, err := NewJanitor(table, clock).Sweep(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Orphaned)
+	assert.Equal(t, []SweptItem{{Pk: emailPk(abandoned), Sk: emailPk(abandoned), Reason: SweepOrphan}}, report.Items)
+
+	var kept legacyEmailEntity
+	assert.NoError(t, table.GetByKey(ctx, emailKey(owned.Email), &kept), "an email with a user must be kept even though it does not name them")
+	_, err = users.AddUser(ctx, util.RandomTestUser(util.WithEmail(abandoned), util.WithCreatedAt(clock.Now())))
+	assert.NoError(t, err, "the abandoned email can be registered again")
+}
+
+func TestJanitorSweep_SkipsItemsChangedSinceScanned(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	table := newTestTableWithoutTTL(clock)
+	users := NewUsersRepo(table, clock)
+	janitor := NewJanitor(table, clock)
+
+	u, err := users.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())), model.Ephemeral)
+	require.NoError(t, err)
+	clock.Advance(2 * time.Hour)
+
+	// the user's lifespan was extended after the scan saw its old ttl
+	err = janitor.delete(ctx, sweepCandidate{
+		entity: sweepEntity{Pk: usernamePK(u.Id), Sk: usernamePK(u.Id), ExpireAt: *u.MetaData.ExpiresAt - 1},
+		reason: SweepExpired,
+	})
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+
+	// the email's user exists, so it is not an orphan after all
+	err = janitor.delete(ctx, sweepCandidate{
+		entity: sweepEntity{Pk: emailPk(u.Email), Sk: emailPk(u.Email), UserId: u.Id},
+		reason: SweepOrphan,
+	})
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+
+	_, err = users.GetUserByEmail(ctx, u.Email)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog"
+)
+
+const PageTokenSecretEnvKey = "PAGE_TOKEN_SECRET"
+
+// MaxPageLimit bounds the limit a caller (e.g. a GraphQL client) can ask for in a single page.
+const MaxPageLimit = 100
+
+// PageTokenCodec turns a LastEvaluatedKey into an opaque nextToken and back. Tokens are signed with an HMAC over
+// the secret and the table/index they were issued for, so a client cannot edit a token to read from an arbitrary
+// key or replay it against a different table.
+type PageTokenCodec struct {
+	secret []byte
+}
+
+// NewPageTokenCodec fails when the secret is empty, as anyone could then sign their own tokens.
+func NewPageTokenCodec(secret []byte) (PageTokenCodec, error) {
+	if len(secret) == 0 {
+		return PageTokenCodec{}, errors.New("page token secret must not be empty")
+	}
+	return PageTokenCodec{secret: secret}, nil
+}
+
+// IsZero is true for a codec that was not created by NewPageTokenCodec. It has no secret, so it refuses to encode
+// or decode tokens.
+func (c PageTokenCodec) IsZero() bool {
+	return len(c.secret) == 0
+}
+
+var errNoPageTokenSecret = fmt.Errorf("page tokens cannot be signed without a secret, set %s", PageTokenSecretEnvKey)
+
+type pageTokenKey map[string]map[string]string
+
+func (c PageTokenCodec) Encode(scope string, lastEvaluatedKey map[string]types.AttributeValue) (string, error) {
+	if len(lastEvaluatedKey) == 0 {
+		return "", nil
+	}
+	if c.IsZero() {
+		return "", errNoPageTokenSecret
+	}
+
+	key := pageTokenKey{}
+	for name, value := range lastEvaluatedKey {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			key[name] = map[string]string{"S": v.Value}
+		case *types.AttributeValueMemberN:
+			key[name] = map[string]string{"N": v.Value}
+		case *types.AttributeValueMemberB:
+			key[name] = map[string]string{"B": base64.StdEncoding.EncodeToString(v.Value)}
+		default:
+			return "", fmt.Errorf("unsupported key attribute type for [%s]", name)
+		}
+	}
+
+	payload, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(scope, encoded)), nil
+}
+
+// Decode verifies and decodes a token produced by Encode for the same scope. An empty token decodes to a nil key,
+// meaning the first page.
+func (c PageTokenCodec) Decode(scope string, token string) (map[string]types.AttributeValue, error) {
+	if len(token) == 0 {
+		return nil, nil
+	}
+	if c.IsZero() {
+		return nil, errNoPageTokenSecret
+	}
+
+	invalid := NewValidationFailedError(errors.New("invalid nextToken"))
+
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, invalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(scope, encoded)) {
+		return nil, invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	var key pageTokenKey
+	if err := json.Unmarshal(payload, &key); err != nil {
+		return nil, invalid
+	}
+
+	out := map[string]types.AttributeValue{}
+	for name, value := range key {
+		switch {
+		case len(value["S"]) > 0:
+			out[name] = &types.AttributeValueMemberS{Value: value["S"]}
+		case len(value["N"]) > 0:
+			out[name] = &types.AttributeValueMemberN{Value: value["N"]}
+		case len(value["B"]) > 0:
+			b, err := base64.StdEncoding.DecodeString(value["B"])
+			if err != nil {
+				return nil, invalid
+			}
+			out[name] = &types.AttributeValueMemberB{Value: b}
+		default:
+			return nil, invalid
+		}
+	}
+	return out, nil
+}
+
+func (c PageTokenCodec) sign(scope string, encoded string) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write([]byte(scope))
+	h.Write([]byte{0})
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
+
+func (r *DynamoRepository) pageScope(indexName *string) string {
+	return r.Tablename + "/" + aws.ToString(indexName)
+}
+
+func validatePageLimit(limit int32) error {
+	if limit < 1 || limit > MaxPageLimit {
+		return NewValidationFailedError(fmt.Errorf("limit must be between 1 and %d but was %d", MaxPageLimit, limit))
+	}
+	return nil
+}
+
+// QueryPage reads a single page of at most limit items starting from nextToken, unmarshalling them into models.
+// The returned token is empty once there are no more pages.
+func (r *DynamoRepository) QueryPage(ctx context.Context, input *dynamodb.QueryInput, limit int32, nextToken string, models interface{}) (string, error) {
+	if err := validatePageLimit(limit); err != nil {
+		return "", err
+	}
+
+	startKey, err := r.PageTokens.Decode(r.pageScope(input.IndexName), nextToken)
+	if err != nil {
+		return "", err
+	}
+
+	input.TableName = aws.String(r.Tablename)
+	input.Limit = aws.Int32(limit)
+	input.ExclusiveStartKey = startKey
+
+	result, err := r.Client.Query(ctx, input)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to query table page")
+		return "", TranslateError(err)
+	}
+
+	return r.unmarshalPage(ctx, input.IndexName, result.Items, result.LastEvaluatedKey, models)
+}
+
+// ScanPage is QueryPage for scans. input may be nil to scan the whole table.
+func (r *DynamoRepository) ScanPage(ctx context.Context, input *dynamodb.ScanInput, limit int32, nextToken string, models interface{}) (string, error) {
+	if err := validatePageLimit(limit); err != nil {
+		return "", err
+	}
+	if input == nil {
+		input = &dynamodb.ScanInput{}
+	}
+
+	startKey, err := r.PageTokens.Decode(r.pageScope(input.IndexName), nextToken)
+	if err != nil {
+		return "", err
+	}
+
+	input.TableName = aws.String(r.Tablename)
+	input.Limit = aws.Int32(limit)
+	input.ExclusiveStartKey = startKey
+
+	result, err := r.Client.Scan(ctx, input)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to scan table page")
+		return "", TranslateError(err)
+	}
+
+	return r.unmarshalPage(ctx, input.IndexName, result.Items, result.LastEvaluatedKey, models)
+}
+
+func (r *DynamoRepository) unmarshalPage(ctx context.Context, indexName *string, items []map[string]types.AttributeValue, lastEvaluatedKey map[string]types.AttributeValue, models interface{}) (string, error) {
+	if err := attributevalue.UnmarshalListOfMaps(items, models); err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to unmarshal list of items")
+		return "", err
+	}
+	return r.PageTokens.Encode(r.pageScope(indexName), lastEvaluatedKey)
+}
+
+// PageIterator walks every page of a query or scan, following LastEvaluatedKey until the results are exhausted.
+//
+//	pages := repo.QueryPages(input)
+//	for pages.HasMorePages() {
+//		var entities []entity
+//		if err := pages.NextPage(ctx, &entities); err != nil { ... }
+//	}
+type PageIterator struct {
+	hasMorePages func() bool
+	nextPage     func(ctx context.Context) ([]map[string]types.AttributeValue, error)
+}
+
+func (p *PageIterator) HasMorePages() bool {
+	return p.hasMorePages()
+}
+
+// NextPage reads the next page and unmarshals its items into models, which is overwritten on each call.
+func (p *PageIterator) NextPage(ctx context.Context, models interface{}) error {
+	items, err := p.nextPage(ctx)
+	if err != nil {
+		return TranslateError(err)
+	}
+	return attributevalue.UnmarshalListOfMaps(items, models)
+}
+
+func (r *DynamoRepository) QueryPages(input *dynamodb.QueryInput) *PageIterator {
+	input.TableName = aws.String(r.Tablename)
+	paginator := dynamodb.NewQueryPaginator(r.Client, input)
+	return &PageIterator{
+		hasMorePages: paginator.HasMorePages,
+		nextPage: func(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return page.Items, nil
+		},
+	}
+}
+
+func (r *DynamoRepository) ScanPages(input *dynamodb.ScanInput) *PageIterator {
+	if input == nil {
+		input = &dynamodb.ScanInput{}
+	}
+	input.TableName = aws.String(r.Tablename)
+	paginator := dynamodb.NewScanPaginator(r.Client, input)
+	return &PageIterator{
+		hasMorePages: paginator.HasMorePages,
+		nextPage: func(ctx context.Context) ([]map[string]types.AttributeValue, error) {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return page.Items, nil
+		},
+	}
+}
+
+// collectPages reads every page into a single list of items.
+func collectPages(ctx context.Context, pages *PageIterator) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	for pages.HasMorePages() {
+		page, err := pages.nextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+	}
+	return items, nil
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pagedEntity struct {
+	Pk string `dynamodbav:"pk"`
+	Sk string `dynamodbav:"sk"`
+}
+
+func newTestPageTokenCodec(t *testing.T, secret string) PageTokenCodec {
+	codec, err := NewPageTokenCodec([]byte(secret))
+	require.NoError(t, err)
+	return codec
+}
+
+func newPagedRepository(t *testing.T, count int) *DynamoRepository {
+	repo := NewInMemoryRepository(util.NewRealClock(), testTable)
+	repo.PageTokens = newTestPageTokenCodec(t, "secret")
+	for i := 0; i < count; i++ {
+		require.NoError(t, repo.Put(context.TODO(), pagedEntity{Pk: "P", Sk: fmt.Sprintf("%03d", i)}))
+	}
+	return repo
+}
+
+func partitionQuery() *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": attrS("P")},
+	}
+}
+
+func TestQueryPage_FollowsNextToken(t *testing.T) {
+	ctx := context.TODO()
+	repo := newPagedRepository(t, 5)
+
+	var seen []string
+	token := ""
+	for pages := 0; pages < 10; pages++ {
+		var entities []pagedEntity
+		next, err := repo.QueryPage(ctx, partitionQuery(), 2, token, &entities)
+		require.NoError(t, err)
+		for _, e := range entities {
+			seen = append(seen, e.Sk)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	assert.Equal(t, []string{"000", "001", "002", "003", "004"}, seen)
+}
+
+func TestQueryPage_RejectsTamperedTokens(t *testing.T) {
+	ctx := context.TODO()
+	repo := newPagedRepository(t, 3)
+
+	var entities []pagedEntity
+	token, err := repo.QueryPage(ctx, partitionQuery(), 1, "", &entities)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	forged, err := newTestPageTokenCodec(t, "guess").Encode(repo.pageScope(nil), map[string]types.AttributeValue{"pk": attrS("P"), "sk": attrS("002")})
+	require.NoError(t, err)
+
+	for _, bad := range []string{token + "x", "not-a-token", forged} {
+		_, err = repo.QueryPage(ctx, partitionQuery(), 1, bad, &entities)
+		assert.True(t, errors.Is(err, ErrValidationFailed), "token %q should be rejected", bad)
+	}
+
+	_, err = repo.QueryPage(ctx, &dynamodb.QueryInput{
+		IndexName:                 aws.String("other-index"),
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": attrS("P")},
+	}, 1, token, &entities)
+	assert.True(t, errors.Is(err, ErrValidationFailed), "tokens are bound to the index they were issued for")
+
+	_, err = repo.QueryPage(ctx, partitionQuery(), MaxPageLimit+1, "", &entities)
+	assert.True(t, errors.Is(err, ErrValidationFailed))
+}
+
+func TestQueryPages_StreamsEveryPage(t *testing.T) {
+	ctx := context.TODO()
+	repo := newPagedRepository(t, 7)
+
+	input := partitionQuery()
+	input.Limit = aws.Int32(3)
+	pages := repo.QueryPages(input)
+
+	total := 0
+	for pages.HasMorePages() {
+		var entities []pagedEntity
+		require.NoError(t, pages.NextPage(ctx, &entities))
+		assert.LessOrEqual(t, len(entities), 3)
+		total += len(entities)
+	}
+	assert.Equal(t, 7, total)
+
+	var all []pagedEntity
+	require.NoError(t, repo.Query(ctx, input, &all))
+	assert.Len(t, all, 7, "Query should not drop pages after the first")
+}
+
+func TestPageTokenCodec_RoundTrip(t *testing.T) {
+	codec := newTestPageTokenCodec(t, "secret")
+	key := map[string]types.AttributeValue{
+		"pk":    attrS("PRODUCT#1"),
+		"price": attrN(42),
+		"bin":   &types.AttributeValueMemberB{Value: []byte{1, 2, 3}},
+	}
+
+	token, err := codec.Encode("table/", key)
+	require.NoError(t, err)
+
+	decoded, err := codec.Decode("table/", token)
+	require.NoError(t, err)
+	assert.Equal(t, key, decoded)
+
+	_, err = codec.Decode("other/", token)
+	assert.Error(t, err)
+
+	empty, err := codec.Encode("table/", nil)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func TestPageTokenCodec_RequiresSecret(t *testing.T) {
+	_, err := NewPageTokenCodec(nil)
+	assert.Error(t, err)
+
+	key := map[string]types.AttributeValue{"pk": attrS("P"), "sk": attrS("001")}
+	_, err = PageTokenCodec{}.Encode("table/", key)
+	assert.Error(t, err, "a codec with no secret must not sign tokens")
+
+	token, err := newTestPageTokenCodec(t, "secret").Encode("table/", key)
+	require.NoError(t, err)
+	_, err = PageTokenCodec{}.Decode("table/", token)
+	assert.Error(t, err)
+
+	// a repository that never pages starts without the secret and only fails when a token is needed
+	t.Setenv(PageTokenSecretEnvKey, "")
+	t.Setenv("CMYK_TABLE", "cmyk-users")
+	instance, err := NewInstance(context.TODO(), "local", "CMYK_TABLE")
+	require.NoError(t, err)
+	_, err = instance.PageTokens.Encode("table/", key)
+	assert.ErrorContains(t, err, PageTokenSecretEnvKey)
+}
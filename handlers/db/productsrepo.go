@@ -0,0 +1,418 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/colour"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+type ProductsRepo struct {
+	ddb      Repository
+	products *DomainTable[productEntity, *model.Product]
+	clock    util.Clock
+	ids      util.IDGenerator
+}
+
+func NewProductsTableRepo(ctx context.Context, region string, options ...DynamoDBOption) (*ProductsRepo, error) {
+	instance, err := NewInstance(ctx, region, ProductsTableEnvKey, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProductsRepo(instance, util.NewRealClock()), nil
+}
+
+// NewProductsRepo creates a ProductsRepo over any Repository, such as one returned by NewInMemoryRepository.
+func NewProductsRepo(repository Repository, clock util.Clock, options ...ProductsRepoOption) *ProductsRepo {
+	r := &ProductsRepo{
+		ddb:      repository,
+		products: NewDomainTable[productEntity, *model.Product](repository, PkSkKey("PRODUCT"), productMapping),
+		clock:    clock,
+		ids:      util.NewIDGenerator(clock),
+	}
+
+	for _, option := range options {
+		r = option(r)
+	}
+
+	return r
+}
+
+type ProductsRepoOption = func(r *ProductsRepo) *ProductsRepo
+
+// WithIDGenerator sets how new products are given ids, e.g. util.NewSeededIDGenerator for repeatable ids in tests.
+func WithIDGenerator(ids util.IDGenerator) ProductsRepoOption {
+	return func(r *ProductsRepo) *ProductsRepo {
+		return &ProductsRepo{
+			ddb:      r.ddb,
+			products: r.products,
+			clock:    r.clock,
+			ids:      ids,
+		}
+	}
+}
+
+// ColourBucketIndexName is the products table index keyed by the quantised Lab colour of each product, see
+// colour.Bucket. It is declared in serverless.yml and tables.Products.
+const ColourBucketIndexName = "colourBucket-index"
+
+var ColourBucketIndex = types.GlobalSecondaryIndex{
+	IndexName: aws.String(ColourBucketIndexName),
+	KeySchema: []types.KeySchemaElement{
+		{AttributeName: aws.String("colourBucket"), KeyType: types.KeyTypeHash},
+		{AttributeName: aws.String("pk"), KeyType: types.KeyTypeRange},
+	},
+	Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+}
+
+// colourBucketWorkers bounds the number of bucket queries QueryColourBuckets runs at once.
+const colourBucketWorkers = 8
+
+var productPK = func(id string) string { return pk("PRODUCT", id) }
+
+var productMapping = Mapping[productEntity, *model.Product]{
+	ToDomain: func(entity productEntity) (*model.Product, error) { return entity.ToProduct() },
+	ToEntity: func(product *model.Product) (productEntity, error) { return createProductEntity(*product), nil },
+}
+
+// CreateProduct stores a new product, assigning it a prod_ ULID when it has no id. An AlreadyExistsError is returned
+// when a product with the id exists.
+func (r *ProductsRepo) CreateProduct(ctx context.Context, product model.Product) (*model.Product, error) {
+	if err := validateModel("product", product); err != nil {
+		return nil, err
+	}
+	rgb, err := parseProductColour(product)
+	if err != nil {
+		return nil, err
+	}
+	if product.Price, err = parseProductPrice(product); err != nil {
+		return nil, err
+	}
+	product.Rgb = rgb.Hex()
+
+	if len(product.Id) == 0 {
+		product.Id, err = r.ids.NewID(util.ProductIDPrefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := r.clock.Now()
+	product.CreatedAt = now.UTC()
+	product.UpdatedAt = now.UTC()
+
+	entity := createProductEntity(product)
+	err = r.ddb.PutIfNotExists(ctx, entity)
+	if errors.Is(err, ErrConditionFailed) {
+		return nil, NewAlreadyExistsError(fmt.Errorf("product [%s] already exists: %w", product.Id, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("product", product.Id).Msg("added product to table")
+	return entity.ToProduct()
+}
+
+func (r *ProductsRepo) GetProduct(ctx context.Context, id string) (*model.Product, error) {
+	return r.products.Get(ctx, id)
+}
+
+// GetProducts reads many products at once in the order of ids. Unknown ids are skipped.
+func (r *ProductsRepo) GetProducts(ctx context.Context, ids []string) ([]*model.Product, error) {
+	return r.products.BatchGet(ctx, ids)
+}
+
+// UpdateProduct replaces the description, colour and price of an existing product, returning a NotFoundError when
+// there is no product with its id. As with UsersRepo.UpdateProfile the update is conditional on the version read,
+// and on product.Version when it is set, so a concurrent or stale change fails with a ConditionFailedError rather
+// than overwriting a newer one.
+func (r *ProductsRepo) UpdateProduct(ctx context.Context, product model.Product) (*model.Product, error) {
+	if err := validateModel("product", product); err != nil {
+		return nil, err
+	}
+	rgb, err := parseProductColour(product)
+	if err != nil {
+		return nil, err
+	}
+	if product.Price, err = parseProductPrice(product); err != nil {
+		return nil, err
+	}
+
+	entity, err := r.products.Table.GetConsistent(ctx, product.Id)
+	if err != nil {
+		return nil, err
+	}
+	if product.Version != 0 && product.Version != entity.Version {
+		return nil, NewConditionFailedError(fmt.Errorf("product [%s] is at version %d not %d", product.Id, entity.Version, product.Version), "")
+	}
+
+	condition, values := versionCondition(entity.Version)
+	values[":rgb"] = &types.AttributeValueMemberS{Value: rgb.Hex()}
+	values[":colourBucket"] = &types.AttributeValueMemberS{Value: colourBucketOf(rgb)}
+	values[":description"] = &types.AttributeValueMemberS{Value: product.Description}
+	values[":price"] = &types.AttributeValueMemberS{Value: product.Price.Price.String()}
+	values[":currencyCode"] = &types.AttributeValueMemberS{Value: string(product.Price.CurrencyCode)}
+	values[":updatedAt"] = &types.AttributeValueMemberS{Value: r.clock.Now().UTC().Format(time.RFC3339)}
+	values[":next"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(entity.Version+1, 10)}
+
+	err = r.ddb.Update(ctx, &dynamodb.UpdateItemInput{
+		Key:                       r.products.Key(product.Id),
+		UpdateExpression:          aws.String("SET rgb = :rgb, colourBucket = :colourBucket, description = :description, price = :price, currencyCode = :currencyCode, updatedAt = :updatedAt, version = :next"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		// the product may have been deleted rather than changed since it was read
+		if _, getErr := r.products.Table.GetConsistent(ctx, product.Id); errors.Is(getErr, ErrNotFound) {
+			return nil, NewNotFoundError(fmt.Errorf("product [%s] not found", product.Id))
+		}
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("product", product.Id).Msg("failed to update product")
+		return nil, err
+	}
+
+	return r.products.GetConsistent(ctx, product.Id)
+}
+
+func (r *ProductsRepo) DeleteProduct(ctx context.Context, id string) error {
+	return r.products.Delete(ctx, id)
+}
+
+// ListProducts reads a page of at most limit products. Pass the returned token back to read the next page; it is
+// empty after the last one. The scan is filtered to products, so it keeps reading until the page is full or the
+// table is exhausted rather than return a short or empty page with a token.
+func (r *ProductsRepo) ListProducts(ctx context.Context, limit int32, nextToken string) ([]*model.Product, string, error) {
+	var entities []productEntity
+	next := nextToken
+	for {
+		var page []productEntity
+		var err error
+		next, err = r.ddb.ScanPage(ctx, productsScan(), limit-int32(len(entities)), next, &page)
+		if err != nil {
+			return nil, "", err
+		}
+		entities = append(entities, page...)
+		if next == "" || len(entities) >= int(limit) {
+			break
+		}
+	}
+
+	products, err := mapAll(entities, productMapping.ToDomain)
+	return products, next, err
+}
+
+// QueryColourBuckets reads the products in each of the buckets through the colour bucket index, running the queries
+// concurrently. Products written before the index existed are missing until BackfillColourBuckets has run.
+func (r *ProductsRepo) QueryColourBuckets(ctx context.Context, buckets []colour.Bucket) ([]*model.Product, error) {
+	results := make([][]productEntity, len(buckets))
+	errs := make([]error, len(buckets))
+	forEachChunk(len(buckets), colourBucketWorkers, func(i int) {
+		errs[i] = r.ddb.Query(ctx, &dynamodb.QueryInput{
+			IndexName:              aws.String(ColourBucketIndexName),
+			KeyConditionExpression: aws.String("colourBucket = :colourBucket"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":colourBucket": &types.AttributeValueMemberS{Value: buckets[i].String()},
+			},
+		}, &results[i])
+	})
+
+	var products []*model.Product
+	for i, entities := range results {
+		if errs[i] != nil {
+			zerolog.Ctx(ctx).Err(errs[i]).Str("colourBucket", buckets[i].String()).Msg("Failed to query colour bucket")
+			return nil, errs[i]
+		}
+		page, err := mapAll(entities, productMapping.ToDomain)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, page...)
+	}
+	return products, nil
+}
+
+// BackfillReport counts what BackfillColourBuckets found. Invalid products have an rgb that cannot be parsed and
+// are left out of the index.
+type BackfillReport struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Invalid int `json:"invalid"`
+}
+
+// BackfillColourBuckets sets the colour bucket of every product that is missing one or has a stale one. With dryRun
+// the report is produced without writing anything. Products changed since they were scanned are skipped because
+// the change already wrote their bucket.
+func (r *ProductsRepo) BackfillColourBuckets(ctx context.Context, dryRun bool) (BackfillReport, error) {
+	logger := zerolog.Ctx(ctx)
+	pages := r.ddb.ScanPages(productsScan())
+
+	var report BackfillReport
+	var mu sync.Mutex
+	for pages.HasMorePages() {
+		var entities []productEntity
+		if err := pages.NextPage(ctx, &entities); err != nil {
+			logger.Err(err).Msg("Failed to scan products")
+			return report, err
+		}
+
+		report.Scanned += len(entities)
+		var stale []productEntity
+		for _, entity := range entities {
+			rgb, err := colour.ParseHex(entity.Rgb)
+			switch {
+			case err != nil:
+				logger.Warn().Str("pk", entity.Pk).Str("rgb", entity.Rgb).Msg("product has an invalid colour")
+				report.Invalid++
+			case entity.ColourBucket == colourBucketOf(rgb):
+				report.Skipped++
+			default:
+				entity.ColourBucket = colourBucketOf(rgb)
+				stale = append(stale, entity)
+			}
+		}
+		if dryRun {
+			report.Updated += len(stale)
+			continue
+		}
+
+		errs := make([]error, len(stale))
+		forEachChunk(len(stale), colourBucketWorkers, func(i int) {
+			err := r.setColourBucket(ctx, stale[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, ErrConditionFailed) {
+				report.Skipped++
+				return
+			}
+			errs[i] = err
+			if err == nil {
+				report.Updated++
+			}
+		})
+		if err := errors.Join(errs...); err != nil {
+			logger.Err(err).Msg("Failed to backfill colour buckets")
+			return report, err
+		}
+	}
+
+	logger.Info().Interface("report", report).Bool("dryRun", dryRun).Msg("backfilled colour buckets")
+	return report, nil
+}
+
+// setColourBucket writes the bucket only while the product still has the colour it was computed from.
+func (r *ProductsRepo) setColourBucket(ctx context.Context, entity productEntity) error {
+	return r.ddb.Update(ctx, &dynamodb.UpdateItemInput{
+		Key:                 map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: entity.Pk}, "sk": &types.AttributeValueMemberS{Value: entity.Sk}},
+		UpdateExpression:    aws.String("SET colourBucket = :colourBucket"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND rgb = :rgb"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":colourBucket": &types.AttributeValueMemberS{Value: entity.ColourBucket},
+			":rgb":          &types.AttributeValueMemberS{Value: entity.Rgb},
+		},
+	})
+}
+
+func parseProductColour(product model.Product) (colour.RGB, error) {
+	rgb, err := colour.Parse(product.Rgb)
+	if err != nil {
+		return colour.RGB{}, NewValidationFailedError(fmt.Errorf("product [%s]: %w", product.Id, err))
+	}
+	return rgb, nil
+}
+
+// parseProductPrice checks the price against the rules of model.NewMoney, which has no validate tags to enforce them,
+// and returns it with its currency code in canonical form.
+func parseProductPrice(product model.Product) (model.Money, error) {
+	price, err := model.NewMoney(product.Price.Price.String(), product.Price.CurrencyCode)
+	if err != nil {
+		return model.Money{}, NewValidationFailedError(fmt.Errorf("product [%s]: %w", product.Id, err))
+	}
+	return price, nil
+}
+
+func colourBucketOf(rgb colour.RGB) string {
+	return colour.BucketOf(rgb.Lab()).String()
+}
+
+func productsScan() *dynamodb.ScanInput {
+	return &dynamodb.ScanInput{
+		FilterExpression:          aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":prefix": &types.AttributeValueMemberS{Value: productPK("")}},
+	}
+}
+
+func createProductEntity(product model.Product) productEntity {
+	var bucket string
+	if rgb, err := colour.ParseHex(product.Rgb); err == nil {
+		bucket = colourBucketOf(rgb)
+	}
+	return productEntity{
+		Pk:           productPK(product.Id),
+		Sk:           productPK(product.Id),
+		Rgb:          product.Rgb,
+		ColourBucket: bucket,
+		Description:  product.Description,
+		Price:        product.Price.Price.String(),
+		CurrencyCode: string(product.Price.CurrencyCode),
+		CreatedAt:    product.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    product.UpdatedAt.Format(time.RFC3339),
+		Version:      max(product.Version, 1),
+	}
+}
+
+// productEntity stores the price as a string rather than a number so the scale it was entered with is kept. The
+// colour bucket is left out when the rgb cannot be parsed so the product does not appear in the index.
+type productEntity struct {
+	Pk           string `dynamodbav:"pk" validate:"required"`
+	Sk           string `dynamodbav:"sk" validate:"required"`
+	Rgb          string `dynamodbav:"rgb" validate:"required"`
+	ColourBucket string `dynamodbav:"colourBucket,omitempty"`
+	Description  string `dynamodbav:"description" validate:"required"`
+	Price        string `dynamodbav:"price" validate:"required"`
+	CurrencyCode string `dynamodbav:"currencyCode" validate:"required"`
+	CreatedAt    string `dynamodbav:"createdAt" validate:"required"`
+	UpdatedAt    string `dynamodbav:"updatedAt"`
+	Version      int64  `dynamodbav:"version"`
+}
+
+func (pe *productEntity) ToProduct() (*model.Product, error) {
+	createdAt, err := time.Parse(time.RFC3339, pe.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	updatedAt := createdAt
+	if len(pe.UpdatedAt) > 0 {
+		if updatedAt, err = time.Parse(time.RFC3339, pe.UpdatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	price, err := model.ParseDecimal(pe.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Product{
+		Id:          strings.TrimPrefix(pe.Pk, productPK("")),
+		Rgb:         pe.Rgb,
+		Description: pe.Description,
+		Price:       model.Money{Price: price, CurrencyCode: model.CurrencyCode(pe.CurrencyCode)},
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+		Version:     pe.Version,
+	}, nil
+}
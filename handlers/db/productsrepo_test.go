@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/joho/godotenv"
+	"github.com/projects/cmyk-api/handlers/colour"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProductsRepo returns a repo backed by the in-memory DynamoDB in short mode and by the table configured in
+// .env.local otherwise.
+func newTestProductsRepo(t *testing.T) *ProductsRepo {
+	if testing.Short() {
+		table := NewInMemoryRepository(util.NewRealClock(), "cmyk-products", ColourBucketIndex)
+		table.PageTokens = newTestPageTokenCodec(t, "secret")
+		return NewProductsRepo(table, util.NewRealClock())
+	}
+
+	err := godotenv.Load(fmt.Sprintf("../../.env.local"))
+	require.NoError(t, err)
+	region := util.GetOSEnvOrFail(t, "AWS_REGION")
+	_ = util.GetOSEnvOrFail(t, "PRODUCTS_TABLE")
+
+	repo, err := NewProductsTableRepo(context.TODO(), region)
+	require.NoError(t, err)
+	return repo
+}
+
+func randomTestProduct(t *testing.T) model.Product {
+	price, err := model.NewMoney(fmt.Sprintf("%d.%02d", gofakeit.Number(1, 99), gofakeit.Number(0, 99)), model.GBP)
+	require.NoError(t, err)
+	return model.Product{
+		Rgb:         fmt.Sprintf("#%06X", gofakeit.Number(0, 0xFFFFFF)),
+		Description: gofakeit.Sentence(6),
+		Price:       price,
+	}
+}
+
+func TestCreateAndGetProduct(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	product := randomTestProduct(t)
+	product.Price = model.Money{Price: model.MustParseDecimal("12.90"), CurrencyCode: model.USD}
+
+	created, err := repo.CreateProduct(ctx, product)
+	require.NoError(t, err)
+	require.NotEmpty(t, created.Id)
+
+	got, err := repo.GetProduct(ctx, created.Id)
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+	assert.Equal(t, "12.90", got.Price.Price.String(), "the price should keep its scale")
+
+	product.Id = created.Id
+	_, err = repo.CreateProduct(ctx, product)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+}
+
+func TestCreateProduct_AssignsProductIDs(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	newRepo := func() *ProductsRepo {
+		return NewProductsRepo(NewInMemoryRepository(clock, "cmyk-products", ColourBucketIndex), clock,
+			WithIDGenerator(util.NewSeededIDGenerator(clock, 1)))
+	}
+	repo, again := newRepo(), newRepo()
+
+	first, err := repo.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+	second, err := repo.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+
+	_, err = util.ParseID(util.ProductIDPrefix, first.Id)
+	require.NoError(t, err)
+	assert.Less(t, first.Id, second.Id, "ids created in the same millisecond keep their order")
+
+	repeated, err := again.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+	assert.Equal(t, first.Id, repeated.Id, "a seeded generator repeats its ids")
+}
+
+func TestUpdateProduct(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	created, err := repo.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+
+	created.Description = "updated"
+	created.Price.Price = model.MustParseDecimal("0.99")
+	updated, err := repo.UpdateProduct(ctx, *created)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", updated.Description)
+	assert.True(t, model.MustParseDecimal("0.99").Equal(updated.Price.Price))
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	assert.EqualValues(t, 2, updated.Version)
+
+	_, err = repo.UpdateProduct(ctx, model.Product{Id: "missing", Rgb: "#000000", Description: "x", Price: created.Price})
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// created was read at version 1, so its change would overwrite the update above
+	created.Description = "stale"
+	_, err = repo.UpdateProduct(ctx, *created)
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+	got, err := repo.GetProduct(ctx, created.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", got.Description)
+}
+
+func TestDeleteProduct(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	created, err := repo.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteProduct(ctx, created.Id))
+	_, err = repo.GetProduct(ctx, created.Id)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestListProducts(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	created := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		p, err := repo.CreateProduct(ctx, randomTestProduct(t))
+		require.NoError(t, err)
+		created[p.Id] = true
+	}
+
+	listed := map[string]bool{}
+	token := ""
+	for {
+		products, next, err := repo.ListProducts(ctx, 2, token)
+		require.NoError(t, err)
+		for _, p := range products {
+			listed[p.Id] = true
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	for id := range created {
+		assert.True(t, listed[id], "product [%s] should be listed", id)
+	}
+}
+
+func TestListProducts_SkipsPagesWithNoProducts(t *testing.T) {
+
+	ctx := context.TODO()
+	table := NewInMemoryRepository(util.NewRealClock(), "cmyk-products", ColourBucketIndex)
+	table.PageTokens = newTestPageTokenCodec(t, "secret")
+	repo := NewProductsRepo(table, util.NewRealClock())
+
+	// items that are not products are scanned first and filtered out of every page they fill
+	for i := 0; i < 5; i++ {
+		require.NoError(t, table.Put(ctx, pagedEntity{Pk: fmt.Sprintf("OTHER#%d", i), Sk: fmt.Sprintf("OTHER#%d", i)}))
+	}
+	for i := 0; i < 3; i++ {
+		_, err := repo.CreateProduct(ctx, randomTestProduct(t))
+		require.NoError(t, err)
+	}
+
+	products, next, err := repo.ListProducts(ctx, 2, "")
+	require.NoError(t, err)
+	assert.Len(t, products, 2)
+	require.NotEmpty(t, next)
+
+	products, next, err = repo.ListProducts(ctx, 2, next)
+	require.NoError(t, err)
+	assert.Len(t, products, 1)
+	assert.Empty(t, next)
+}
+
+func TestCreateProduct_NormalisesColour(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	product := randomTestProduct(t)
+	product.Rgb = "rgb(51, 102, 153)"
+	created, err := repo.CreateProduct(ctx, product)
+	require.NoError(t, err)
+	assert.Equal(t, "#336699", created.Rgb)
+
+	product.Rgb = "not a colour"
+	_, err = repo.CreateProduct(ctx, product)
+	assert.True(t, errors.Is(err, ErrValidationFailed))
+}
+
+func TestCreateProduct_Validation(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	product := randomTestProduct(t)
+	product.Rgb = ""
+	product.Description = ""
+	_, err := repo.CreateProduct(ctx, product)
+
+	var invalid ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.True(t, errors.Is(err, ErrValidationFailed))
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "rgb", Rule: "required"},
+		{Field: "description", Rule: "required"},
+	}, invalid.Fields)
+}
+
+func TestProduct_PriceValidation(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	created, err := repo.CreateProduct(ctx, randomTestProduct(t))
+	require.NoError(t, err)
+
+	for name, price := range map[string]model.Money{
+		"negative":         {Price: model.MustParseDecimal("-1.00"), CurrencyCode: model.GBP},
+		"too many places":  {Price: model.MustParseDecimal("9.999"), CurrencyCode: model.GBP},
+		"no currency":      {Price: model.MustParseDecimal("9.99")},
+		"unknown currency": {Price: model.MustParseDecimal("9.99"), CurrencyCode: "XYZ"},
+	} {
+		product := randomTestProduct(t)
+		product.Price = price
+		_, err := repo.CreateProduct(ctx, product)
+		assert.True(t, errors.Is(err, ErrValidationFailed), "create with %s price", name)
+
+		update := *created
+		update.Price = price
+		_, err = repo.UpdateProduct(ctx, update)
+		assert.True(t, errors.Is(err, ErrValidationFailed), "update with %s price", name)
+	}
+
+	got, err := repo.GetProduct(ctx, created.Id)
+	require.NoError(t, err)
+	assert.Equal(t, created.Price, got.Price, "a rejected price must not be written")
+
+	// the currency code is stored in its canonical form
+	product := randomTestProduct(t)
+	product.Price.CurrencyCode = "usd"
+	usd, err := repo.CreateProduct(ctx, product)
+	require.NoError(t, err)
+	assert.Equal(t, model.USD, usd.Price.CurrencyCode)
+}
+
+func TestQueryColourBuckets(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	red := randomTestProduct(t)
+	red.Rgb = "#FF0000"
+	created, err := repo.CreateProduct(ctx, red)
+	require.NoError(t, err)
+
+	redBucket := colour.BucketOf(colour.RGB{R: 255}.Lab())
+	products, err := repo.QueryColourBuckets(ctx, redBucket.Ring(0))
+	require.NoError(t, err)
+	assert.Contains(t, products, created)
+
+	// recolouring a product moves it to the bucket of its new colour
+	created.Rgb = "#0000FF"
+	_, err = repo.UpdateProduct(ctx, *created)
+	require.NoError(t, err)
+
+	products, err = repo.QueryColourBuckets(ctx, redBucket.Ring(0))
+	require.NoError(t, err)
+	for _, p := range products {
+		assert.NotEqual(t, created.Id, p.Id)
+	}
+}
+
+func TestBackfillColourBuckets(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestProductsRepo(t)
+
+	// products written before colour buckets existed
+	var missing []string
+	for i := 0; i < 3; i++ {
+		product := randomTestProduct(t)
+		product.Id = gofakeit.UUID()
+		entity := createProductEntity(product)
+		entity.ColourBucket = ""
+		require.NoError(t, repo.ddb.Put(ctx, entity))
+		missing = append(missing, product.Id)
+	}
+	invalid := createProductEntity(model.Product{Id: gofakeit.UUID(), Rgb: "mauve", Description: "x", Price: randomTestProduct(t).Price})
+	require.NoError(t, repo.ddb.Put(ctx, invalid))
+
+	report, err := repo.BackfillColourBuckets(ctx, true)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, report.Updated, 3)
+	assert.GreaterOrEqual(t, report.Invalid, 1)
+
+	var entity productEntity
+	require.NoError(t, repo.ddb.GetByKey(ctx, repo.products.Key(missing[0]), &entity))
+	assert.Empty(t, entity.ColourBucket, "a dry run should not write")
+
+	report, err = repo.BackfillColourBuckets(ctx, false)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, report.Updated, 3)
+
+	for _, id := range missing {
+		var entity productEntity
+		require.NoError(t, repo.ddb.GetByKey(ctx, repo.products.Key(id), &entity))
+		rgb, err := colour.ParseHex(entity.Rgb)
+		require.NoError(t, err)
+		assert.Equal(t, colour.BucketOf(rgb.Lab()).String(), entity.ColourBucket)
+	}
+
+	report, err = repo.BackfillColourBuckets(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Updated, "a second run should find nothing to do")
+}
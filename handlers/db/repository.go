@@ -5,12 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/rs/zerolog"
-	"log"
 	"os"
 	"strings"
 
@@ -18,36 +16,97 @@ import (
 )
 
 const UsersTableEnvKey = "USERS_TABLE"
+const ProductsTableEnvKey = "PRODUCTS_TABLE"
 
 type Transaction interface {
 	TransactPut(ctx *context.Context, items []*types.TransactWriteItem) error
 	TransactWriteItem(ctx context.Context, item interface{}) (*types.TransactWriteItem, error)
 }
 
+// DynamoDBClient is the subset of the DynamoDB API used by DynamoRepository. It is satisfied by *dynamodb.Client
+// and by InMemoryDynamoDB for tests that should not depend on DynamoDB Local or AWS.
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// Repository is the table level API the domain repositories are written against.
+type Repository interface {
+	GetTablename() string
+	GetByKey(ctx context.Context, key map[string]types.AttributeValue, model interface{}) error
+	GetByKeyConsistent(ctx context.Context, key map[string]types.AttributeValue, model interface{}) error
+	Put(ctx context.Context, model interface{}) error
+	PutIfNotExists(ctx context.Context, model interface{}) error
+	Update(ctx context.Context, input *dynamodb.UpdateItemInput) error
+	Query(ctx context.Context, input *dynamodb.QueryInput, models interface{}) error
+	Scan(ctx context.Context, models interface{}) error
+	QueryPage(ctx context.Context, input *dynamodb.QueryInput, limit int32, nextToken string, models interface{}) (string, error)
+	ScanPage(ctx context.Context, input *dynamodb.ScanInput, limit int32, nextToken string, models interface{}) (string, error)
+	QueryPages(input *dynamodb.QueryInput) *PageIterator
+	ScanPages(input *dynamodb.ScanInput) *PageIterator
+	Delete(ctx context.Context, key map[string]types.AttributeValue) error
+	TransactPut(ctx context.Context, items []types.TransactWriteItem) error
+	BatchGet(ctx context.Context, keys []map[string]types.AttributeValue, models interface{}, options ...BatchOption) error
+	BatchWrite(ctx context.Context, requests []types.WriteRequest, options ...BatchOption) error
+}
+
 type DynamoRepository struct {
 	Tablename string
-	Client    *dynamodb.Client
+	Client    DynamoDBClient
+	// PageTokens signs the nextTokens handed out by QueryPage and ScanPage.
+	PageTokens PageTokenCodec
 }
 
-func NewInstance(ctx context.Context, region string, tablenameKey string) (*DynamoRepository, error) {
+// NewInstance looks up the table name from the tablenameKey environment variable, failing if it is not set, and
+// the secret that signs page tokens from PAGE_TOKEN_SECRET. Without the secret QueryPage and ScanPage fail only
+// once a token has to be signed or read, so repositories that never page do not need it. A DYNAMO_ENDPOINT
+// environment variable, such as the one in .env.local, points the client at DynamoDB Local unless an option
+// overrides it.
+func NewInstance(ctx context.Context, region string, tablenameKey string, options ...DynamoDBOption) (*DynamoRepository, error) {
 	tablename := os.Getenv(tablenameKey)
 
 	if len(tablename) == 0 {
-		return nil, errors.New(fmt.Sprintf("Table name environment variable is not set [%s]", tablename))
+		return nil, errors.New(fmt.Sprintf("Table name environment variable is not set [%s]", tablenameKey))
 	}
 
-	db := NewInstanceWithValues(*zerolog.Ctx(ctx), region, tablename)
-	return &db, nil
+	options = append([]DynamoDBOption{WithEndpoint(os.Getenv(DynamoEndpointEnvKey))}, options...)
+	db, err := NewInstanceWithValues(ctx, region, tablename, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret := os.Getenv(PageTokenSecretEnvKey); len(secret) > 0 {
+		db.PageTokens = PageTokenCodec{secret: []byte(secret)}
+	}
+	return db, nil
 }
 
 // NewInstanceWithValues takes region and tablename as values instead of environment variable keys to be looked up.
 // It allows callers to take responsibility for env var lookup which can make it easier to tell which env vars a lambda needs.
-func NewInstanceWithValues(log zerolog.Logger, region string, tablename string) DynamoRepository {
-	log.With().Str("region", region).Str("tablename", tablename).Logger()
+func NewInstanceWithValues(ctx context.Context, region string, tablename string, options ...DynamoDBOption) (*DynamoRepository, error) {
+	log := zerolog.Ctx(ctx).With().Str("region", region).Str("tablename", tablename).Logger()
 	log.Debug().Msg("DynamoDB instance configuration")
 
+	client, err := NewDynamoDB(ctx, region, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewInstanceWithClient(client, tablename)
+	return &db, nil
+}
+
+// NewInstanceWithClient creates a repository for the table using an already configured client.
+func NewInstanceWithClient(client DynamoDBClient, tablename string) DynamoRepository {
 	return DynamoRepository{
-		Client:    NewDynamoDB(region),
+		Client:    client,
 		Tablename: tablename,
 	}
 }
@@ -56,48 +115,31 @@ func (r *DynamoRepository) GetTablename() string {
 	return r.Tablename
 }
 
-func (r *DynamoRepository) GetClient() *dynamodb.Client {
+func (r *DynamoRepository) GetClient() DynamoDBClient {
 	return r.Client
 }
 
-func NewDynamoDB(region string) *dynamodb.Client {
-
-	awsConfig, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return dynamodb.NewFromConfig(awsConfig)
-}
-
-type NotFoundError struct {
-	StatusCode int
-	Err        error
+func (r *DynamoRepository) GetByKey(ctx context.Context, key map[string]types.AttributeValue, model interface{}) error {
+	return r.getByKey(ctx, key, model, false)
 }
 
-func NewNotFoundError(err error) NotFoundError {
-	return NotFoundError{
-		StatusCode: 404,
-		Err:        err,
-	}
-}
-func (m NotFoundError) Error() string {
-	return m.Err.Error()
+// GetByKeyConsistent is GetByKey with a strongly consistent read, for lookups that must observe writes made
+// moments earlier such as an email uniqueness item resolving to its user.
+func (r *DynamoRepository) GetByKeyConsistent(ctx context.Context, key map[string]types.AttributeValue, model interface{}) error {
+	return r.getByKey(ctx, key, model, true)
 }
 
-func (r *DynamoRepository) GetByKey(ctx context.Context, key map[string]types.AttributeValue, model interface{}) error {
+func (r *DynamoRepository) getByKey(ctx context.Context, key map[string]types.AttributeValue, model interface{}, consistent bool) error {
 
 	result, err := r.Client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(r.Tablename),
-		Key:       key,
+		TableName:      aws.String(r.Tablename),
+		Key:            key,
+		ConsistentRead: aws.Bool(consistent),
 	})
 
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to get item from dynamodb")
-		return err
+		return TranslateError(err)
 	}
 	if result.Item == nil {
 		return NewNotFoundError(errors.New(spew.Sprintf("item not found for key [%s]", key)))
@@ -124,8 +166,32 @@ func (r *DynamoRepository) Put(ctx context.Context, model interface{}) error {
 	})
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to persist model")
+		return TranslateError(err)
+	}
+
+	zerolog.Ctx(ctx).Debug().Any("model", model).Msg("Persisted")
+
+	return nil
+}
+
+// PutIfNotExists is Put conditioned on no item existing with the same key. A ConditionFailedError is returned
+// when there is one.
+func (r *DynamoRepository) PutIfNotExists(ctx context.Context, model interface{}) error {
+
+	av, err := attributevalue.MarshalMap(model)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to marshal into dynamodb map")
 		return err
 	}
+	_, err = r.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(r.Tablename),
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("Failed to persist model")
+		return TranslateError(err)
+	}
 
 	zerolog.Ctx(ctx).Debug().Any("model", model).Msg("Persisted")
 
@@ -140,7 +206,7 @@ func (r *DynamoRepository) TransactPut(ctx context.Context, items []types.Transa
 
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Any("items", items).Msg("Failed to persist all transactional writes")
-		return err
+		return TranslateError(err)
 	}
 	zerolog.Ctx(ctx).Debug().Any("items", items).Msg("Persisted")
 	return nil
@@ -165,21 +231,20 @@ func (r *DynamoRepository) Update(ctx context.Context, input *dynamodb.UpdateIte
 	_, err := r.Client.UpdateItem(ctx, input)
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to update model")
-		return err
+		return TranslateError(err)
 	}
 	return nil
 }
 
+// Scan reads every page of the table. Use ScanPage or ScanPages when the table may be large.
 func (r *DynamoRepository) Scan(ctx context.Context, models interface{}) error {
-	result, err := r.Client.Scan(ctx, &dynamodb.ScanInput{
-		TableName: aws.String(r.Tablename),
-	})
+	items, err := collectPages(ctx, r.ScanPages(nil))
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to scan table")
-		return err
+		return TranslateError(err)
 	}
 
-	err = attributevalue.UnmarshalListOfMaps(result.Items, models)
+	err = attributevalue.UnmarshalListOfMaps(items, models)
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to unmarshal list of items")
 		return err
@@ -187,15 +252,15 @@ func (r *DynamoRepository) Scan(ctx context.Context, models interface{}) error {
 	return nil
 }
 
+// Query reads every page of results. Use QueryPage or QueryPages when the result set may be large.
 func (r *DynamoRepository) Query(ctx context.Context, input *dynamodb.QueryInput, models interface{}) error {
-	input.TableName = aws.String(r.Tablename)
-	result, err := r.Client.Query(ctx, input)
+	items, err := collectPages(ctx, r.QueryPages(input))
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to query table")
-		return err
+		return TranslateError(err)
 	}
 
-	err = attributevalue.UnmarshalListOfMaps(result.Items, models)
+	err = attributevalue.UnmarshalListOfMaps(items, models)
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to unmarshal list of items")
 		return err
@@ -203,14 +268,14 @@ func (r *DynamoRepository) Query(ctx context.Context, input *dynamodb.QueryInput
 	return nil
 }
 
-func (r *DynamoRepository) Delete(ctx context.Context, ID string) error {
+func (r *DynamoRepository) Delete(ctx context.Context, key map[string]types.AttributeValue) error {
 	input := &dynamodb.DeleteItemInput{
-		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: ID}},
+		Key:       key,
 		TableName: aws.String(r.Tablename),
 	}
 	if _, err := r.Client.DeleteItem(ctx, input); err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to delete item")
-		return err
+		return TranslateError(err)
 	}
 
 	return nil
@@ -242,7 +307,7 @@ func (r *DynamoRepository) TransactPutMultiTable(ctx context.Context, arr []Mult
 	})
 	if err != nil {
 		zerolog.Ctx(ctx).Err(err).Msg("Failed to persist all write items in transaction")
-		return err
+		return TranslateError(err)
 	}
 	zerolog.Ctx(ctx).Debug().Any("items", items).Msg("Persisted transactional items")
 	return nil
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeyBuilder turns an id into the primary key of an item, e.g. "42" into pk and sk of USERNAME#42.
+type KeyBuilder = func(id string) map[string]types.AttributeValue
+
+// PkSkKey builds keys for single table items that use the same prefixed value for pk and sk, as the users and
+// email uniqueness items do.
+func PkSkKey(prefix string) KeyBuilder {
+	return func(id string) map[string]types.AttributeValue {
+		value := pk(prefix, id)
+		return map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: value},
+			"sk": &types.AttributeValueMemberS{Value: value},
+		}
+	}
+}
+
+// versionCondition guards an update of an item read at version against concurrent writers. Items written before
+// versioning was introduced have no version attribute and are matched by its absence.
+func versionCondition(version int64) (string, map[string]types.AttributeValue) {
+	if version == 0 {
+		return "attribute_exists(pk) AND attribute_not_exists(version)", map[string]types.AttributeValue{}
+	}
+	return "attribute_exists(pk) AND version = :version", map[string]types.AttributeValue{
+		":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+	}
+}
+
+// Table is a typed view of the items of one entity type E in a Repository, so callers get an E back instead of
+// passing a pointer for the repository to unmarshal into.
+type Table[E any] struct {
+	repository Repository
+	key        KeyBuilder
+}
+
+func NewTable[E any](repository Repository, key KeyBuilder) *Table[E] {
+	return &Table[E]{
+		repository: repository,
+		key:        key,
+	}
+}
+
+func (t *Table[E]) Key(id string) map[string]types.AttributeValue {
+	return t.key(id)
+}
+
+func (t *Table[E]) Repository() Repository {
+	return t.repository
+}
+
+// Get returns the entity with the given id or a NotFoundError.
+func (t *Table[E]) Get(ctx context.Context, id string) (E, error) {
+	var entity E
+	err := t.repository.GetByKey(ctx, t.key(id), &entity)
+	return entity, err
+}
+
+// GetConsistent is Get with a strongly consistent read.
+func (t *Table[E]) GetConsistent(ctx context.Context, id string) (E, error) {
+	var entity E
+	err := t.repository.GetByKeyConsistent(ctx, t.key(id), &entity)
+	return entity, err
+}
+
+func (t *Table[E]) Put(ctx context.Context, entity E) error {
+	return t.repository.Put(ctx, entity)
+}
+
+func (t *Table[E]) Delete(ctx context.Context, id string) error {
+	return t.repository.Delete(ctx, t.key(id))
+}
+
+// Query reads every page of results.
+func (t *Table[E]) Query(ctx context.Context, input *dynamodb.QueryInput) ([]E, error) {
+	var entities []E
+	err := t.repository.Query(ctx, input, &entities)
+	return entities, err
+}
+
+// QueryPage reads a single page, see DynamoRepository.QueryPage.
+func (t *Table[E]) QueryPage(ctx context.Context, input *dynamodb.QueryInput, limit int32, nextToken string) ([]E, string, error) {
+	var entities []E
+	next, err := t.repository.QueryPage(ctx, input, limit, nextToken, &entities)
+	return entities, next, err
+}
+
+// BatchGet returns the entities for ids in the order the ids were given. Ids with no item are skipped rather than
+// failing the whole batch.
+func (t *Table[E]) BatchGet(ctx context.Context, ids []string, options ...BatchOption) ([]E, error) {
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, t.key(id))
+	}
+
+	var entities []E
+	err := t.repository.BatchGet(ctx, keys, &entities, options...)
+	return entities, err
+}
+
+// BatchPut writes entities with BatchWrite, see DynamoRepository.BatchWrite.
+func (t *Table[E]) BatchPut(ctx context.Context, entities []E, options ...BatchOption) error {
+	requests := make([]types.WriteRequest, 0, len(entities))
+	for _, entity := range entities {
+		request, err := NewPutRequest(entity)
+		if err != nil {
+			return err
+		}
+		requests = append(requests, request)
+	}
+	return t.repository.BatchWrite(ctx, requests, options...)
+}
+
+// Mapping converts between a stored entity E and its domain model D, as userEntity.ToUser and createUserEntity
+// do for users.
+type Mapping[E any, D any] struct {
+	ToDomain func(entity E) (D, error)
+	ToEntity func(domain D) (E, error)
+}
+
+// DomainTable is a Table that reads and writes domain models, mapping them to and from their stored entity.
+type DomainTable[E any, D any] struct {
+	*Table[E]
+	mapping Mapping[E, D]
+}
+
+func NewDomainTable[E any, D any](repository Repository, key KeyBuilder, mapping Mapping[E, D]) *DomainTable[E, D] {
+	return &DomainTable[E, D]{
+		Table:   NewTable[E](repository, key),
+		mapping: mapping,
+	}
+}
+
+func (t *DomainTable[E, D]) Get(ctx context.Context, id string) (D, error) {
+	entity, err := t.Table.Get(ctx, id)
+	if err != nil {
+		var zero D
+		return zero, err
+	}
+	return t.mapping.ToDomain(entity)
+}
+
+func (t *DomainTable[E, D]) GetConsistent(ctx context.Context, id string) (D, error) {
+	entity, err := t.Table.GetConsistent(ctx, id)
+	if err != nil {
+		var zero D
+		return zero, err
+	}
+	return t.mapping.ToDomain(entity)
+}
+
+func (t *DomainTable[E, D]) Put(ctx context.Context, domain D) error {
+	entity, err := t.mapping.ToEntity(domain)
+	if err != nil {
+		return err
+	}
+	return t.Table.Put(ctx, entity)
+}
+
+func (t *DomainTable[E, D]) Query(ctx context.Context, input *dynamodb.QueryInput) ([]D, error) {
+	entities, err := t.Table.Query(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return mapAll(entities, t.mapping.ToDomain)
+}
+
+func (t *DomainTable[E, D]) QueryPage(ctx context.Context, input *dynamodb.QueryInput, limit int32, nextToken string) ([]D, string, error) {
+	entities, next, err := t.Table.QueryPage(ctx, input, limit, nextToken)
+	if err != nil {
+		return nil, "", err
+	}
+	domains, err := mapAll(entities, t.mapping.ToDomain)
+	return domains, next, err
+}
+
+// BatchGet maps whatever was read even when some items failed, returning the *BatchError alongside them.
+func (t *DomainTable[E, D]) BatchGet(ctx context.Context, ids []string, options ...BatchOption) ([]D, error) {
+	entities, err := t.Table.BatchGet(ctx, ids, options...)
+	var batchErr *BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, err
+	}
+
+	domains, mapErr := mapAll(entities, t.mapping.ToDomain)
+	if mapErr != nil {
+		return nil, mapErr
+	}
+	return domains, err
+}
+
+func (t *DomainTable[E, D]) BatchPut(ctx context.Context, domains []D, options ...BatchOption) error {
+	entities := make([]E, 0, len(domains))
+	for _, domain := range domains {
+		entity, err := t.mapping.ToEntity(domain)
+		if err != nil {
+			return err
+		}
+		entities = append(entities, entity)
+	}
+	return t.Table.BatchPut(ctx, entities, options...)
+}
+
+func mapAll[E any, D any](entities []E, fn func(E) (D, error)) ([]D, error) {
+	out := make([]D, 0, len(entities))
+	for _, entity := range entities {
+		mapped, err := fn(entity)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mapped)
+	}
+	return out, nil
+}
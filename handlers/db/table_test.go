@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type widgetEntity struct {
+	Pk   string `dynamodbav:"pk"`
+	Sk   string `dynamodbav:"sk"`
+	Name string `dynamodbav:"name"`
+}
+
+type widget struct {
+	ID   string
+	Name string
+}
+
+var widgetMapping = Mapping[widgetEntity, widget]{
+	ToDomain: func(entity widgetEntity) (widget, error) {
+		return widget{ID: strings.TrimPrefix(entity.Pk, "WIDGET#"), Name: entity.Name}, nil
+	},
+	ToEntity: func(w widget) (widgetEntity, error) {
+		return widgetEntity{Pk: pk("WIDGET", w.ID), Sk: pk("WIDGET", w.ID), Name: w.Name}, nil
+	},
+}
+
+func TestTable_GetPutAndBatchGet(t *testing.T) {
+	ctx := context.TODO()
+	widgets := NewTable[widgetEntity](NewInMemoryRepository(util.NewRealClock(), testTable), PkSkKey("WIDGET"))
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, widgets.Put(ctx, widgetEntity{Pk: pk("WIDGET", id), Sk: pk("WIDGET", id), Name: "widget " + id}))
+	}
+
+	got, err := widgets.Get(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "widget 2", got.Name)
+
+	_, err = widgets.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	batch, err := widgets.BatchGet(ctx, []string{"3", "missing", "1"})
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, "widget 3", batch[0].Name)
+	assert.Equal(t, "widget 1", batch[1].Name)
+
+	require.NoError(t, widgets.Delete(ctx, "1"))
+	_, err = widgets.Get(ctx, "1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestDomainTable_MapsEntities(t *testing.T) {
+	ctx := context.TODO()
+	widgets := NewDomainTable(NewInMemoryRepository(util.NewRealClock(), testTable), PkSkKey("WIDGET"), widgetMapping)
+
+	require.NoError(t, widgets.Put(ctx, widget{ID: "42", Name: "answer"}))
+
+	got, err := widgets.GetConsistent(ctx, "42")
+	require.NoError(t, err)
+	assert.Equal(t, widget{ID: "42", Name: "answer"}, got)
+
+	all, err := widgets.Query(ctx, &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": attrS("WIDGET#42")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []widget{{ID: "42", Name: "answer"}}, all)
+}
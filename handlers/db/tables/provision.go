@@ -0,0 +1,317 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// Client is the part of the DynamoDB API that manages tables. *dynamodb.Client and db.InMemoryDynamoDB implement it.
+type Client interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+}
+
+// Tables and indexes are created asynchronously, so the Provisioner waits for them to become active before making
+// the next change, checking every pollInterval for up to maxPolls times.
+const (
+	pollInterval = 2 * time.Second
+	maxPolls     = 300
+)
+
+// Action is a change the Provisioner made to a table. UndeclaredIndex reports an index the schema does not declare
+// that was left in place.
+type Action string
+
+const (
+	CreateTable     Action = "CREATE_TABLE"
+	DeleteTable     Action = "DELETE_TABLE"
+	CreateIndex     Action = "CREATE_INDEX"
+	DeleteIndex     Action = "DELETE_INDEX"
+	UndeclaredIndex Action = "UNDECLARED_INDEX"
+	EnableTTL       Action = "ENABLE_TTL"
+	DisableTTL      Action = "DISABLE_TTL"
+)
+
+type Change struct {
+	Table  string `json:"table"`
+	Action Action `json:"action"`
+	// Name is the index or TTL attribute changed, if any.
+	Name string `json:"name,omitempty"`
+}
+
+// Provisioner makes tables match their Schema. Running it again makes no changes.
+type Provisioner struct {
+	client Client
+	clock  util.Clock
+	prune  bool
+}
+
+type ProvisionerOption = func(p *Provisioner) *Provisioner
+
+// WithPrune deletes the indexes a table has that its schema does not declare, rather than only reporting them.
+func WithPrune() ProvisionerOption {
+	return func(p *Provisioner) *Provisioner {
+		return &Provisioner{
+			client: p.client,
+			clock:  p.clock,
+			prune:  true,
+		}
+	}
+}
+
+// NewProvisioner creates a Provisioner that waits on clock for tables and indexes to become active.
+func NewProvisioner(client Client, clock util.Clock, options ...ProvisionerOption) *Provisioner {
+	p := &Provisioner{
+		client: client,
+		clock:  clock,
+	}
+
+	for _, option := range options {
+		p = option(p)
+	}
+
+	return p
+}
+
+// Ensure creates the table when it does not exist, and otherwise creates the indexes it is missing, reports the
+// indexes that are not declared, deleting them when pruning, and sets its TTL. Keys cannot be changed once a table
+// or index exists, so a table or index whose keys differ from the schema is reported as an error and left alone.
+func (p *Provisioner) Ensure(ctx context.Context, schema Schema, tablename string) ([]Change, error) {
+	logger := zerolog.Ctx(ctx).With().Str("table", tablename).Logger()
+
+	description, err := p.describe(ctx, tablename)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	if description == nil {
+		if _, err := p.client.CreateTable(ctx, schema.CreateTableInput(tablename)); err != nil {
+			logger.Err(err).Msg("Failed to create table")
+			return nil, err
+		}
+		changes = append(changes, Change{Table: tablename, Action: CreateTable})
+		if description, err = p.waitUntilActive(ctx, tablename); err != nil {
+			return changes, err
+		}
+	}
+
+	if !reflect.DeepEqual(keysOf(description.KeySchema), keysOf(schema.KeySchema())) {
+		return changes, fmt.Errorf("table [%s] has keys %v but the schema declares %v, the table must be deleted to change them",
+			tablename, keysOf(description.KeySchema), keysOf(schema.KeySchema()))
+	}
+
+	indexChanges, err := p.ensureIndexes(ctx, schema, tablename, description)
+	changes = append(changes, indexChanges...)
+	if err != nil {
+		return changes, err
+	}
+
+	ttlChanges, err := p.ensureTTL(ctx, schema, tablename)
+	changes = append(changes, ttlChanges...)
+	if err != nil {
+		return changes, err
+	}
+
+	logger.Info().Int("changes", len(changes)).Msg("table matches its schema")
+	return changes, nil
+}
+
+// Delete deletes the table, doing nothing when it does not exist.
+func (p *Provisioner) Delete(ctx context.Context, tablename string) ([]Change, error) {
+	_, err := p.client.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(tablename)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("table", tablename).Msg("Failed to delete table")
+		return nil, err
+	}
+	return []Change{{Table: tablename, Action: DeleteTable}}, nil
+}
+
+func (p *Provisioner) ensureIndexes(ctx context.Context, schema Schema, tablename string, description *types.TableDescription) ([]Change, error) {
+	existing := map[string]types.GlobalSecondaryIndexDescription{}
+	for _, index := range description.GlobalSecondaryIndexes {
+		existing[aws.ToString(index.IndexName)] = index
+	}
+	declared := map[string]bool{}
+
+	var changes []Change
+	for _, index := range schema.Indexes {
+		name := aws.ToString(index.IndexName)
+		declared[name] = true
+
+		if found, ok := existing[name]; ok {
+			if !reflect.DeepEqual(keysOf(found.KeySchema), keysOf(index.KeySchema)) || !sameProjection(found.Projection, index.Projection) {
+				return changes, fmt.Errorf("index [%s] of table [%s] differs from the schema, delete the index to recreate it", name, tablename)
+			}
+			continue
+		}
+
+		// DynamoDB only creates one index per UpdateTable call
+		_, err := p.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            aws.String(tablename),
+			AttributeDefinitions: schema.AttributeDefinitions(),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  index.IndexName,
+					KeySchema:  index.KeySchema,
+					Projection: index.Projection,
+				},
+			}},
+		})
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("table", tablename).Str("index", name).Msg("Failed to create index")
+			return changes, err
+		}
+		changes = append(changes, Change{Table: tablename, Action: CreateIndex, Name: name})
+		if _, err := p.waitUntilActive(ctx, tablename); err != nil {
+			return changes, err
+		}
+	}
+
+	for _, index := range description.GlobalSecondaryIndexes {
+		name := aws.ToString(index.IndexName)
+		if declared[name] {
+			continue
+		}
+		// an index another deployment still queries is only deleted when asked to
+		if !p.prune {
+			changes = append(changes, Change{Table: tablename, Action: UndeclaredIndex, Name: name})
+			continue
+		}
+		_, err := p.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:                   aws.String(tablename),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Delete: &types.DeleteGlobalSecondaryIndexAction{IndexName: index.IndexName}}},
+		})
+		if err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("table", tablename).Str("index", name).Msg("Failed to delete index")
+			return changes, err
+		}
+		changes = append(changes, Change{Table: tablename, Action: DeleteIndex, Name: name})
+		if _, err := p.waitUntilActive(ctx, tablename); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// ensureTTL turns TTL on or off. DynamoDB cannot move TTL to another attribute in one step, so that is an error.
+func (p *Provisioner) ensureTTL(ctx context.Context, schema Schema, tablename string) ([]Change, error) {
+	output, err := p.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tablename)})
+	if err != nil {
+		return nil, err
+	}
+	status, attribute := types.TimeToLiveStatusDisabled, ""
+	if output.TimeToLiveDescription != nil {
+		status, attribute = output.TimeToLiveDescription.TimeToLiveStatus, aws.ToString(output.TimeToLiveDescription.AttributeName)
+	}
+	enabled := status == types.TimeToLiveStatusEnabled || status == types.TimeToLiveStatusEnabling
+
+	switch {
+	case len(schema.TTLAttribute) > 0 && enabled && attribute != schema.TTLAttribute:
+		return nil, fmt.Errorf("table [%s] has TTL on [%s] but the schema declares [%s], disable TTL to change it",
+			tablename, attribute, schema.TTLAttribute)
+	case len(schema.TTLAttribute) > 0 && !enabled:
+		return p.updateTTL(ctx, tablename, schema.TTLAttribute, true)
+	case len(schema.TTLAttribute) == 0 && enabled:
+		return p.updateTTL(ctx, tablename, attribute, false)
+	}
+	return nil, nil
+}
+
+func (p *Provisioner) updateTTL(ctx context.Context, tablename string, attribute string, enabled bool) ([]Change, error) {
+	_, err := p.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tablename),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(enabled),
+		},
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("table", tablename).Bool("enabled", enabled).Msg("Failed to update TTL")
+		return nil, err
+	}
+	action := EnableTTL
+	if !enabled {
+		action = DisableTTL
+	}
+	return []Change{{Table: tablename, Action: action, Name: attribute}}, nil
+}
+
+// describe returns nil when the table does not exist.
+func (p *Provisioner) describe(ctx context.Context, tablename string) (*types.TableDescription, error) {
+	output, err := p.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tablename)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("table", tablename).Msg("Failed to describe table")
+		return nil, err
+	}
+	return output.Table, nil
+}
+
+// waitUntilActive waits for the table and all of its indexes to be active.
+func (p *Provisioner) waitUntilActive(ctx context.Context, tablename string) (*types.TableDescription, error) {
+	for poll := 0; poll < maxPolls; poll++ {
+		description, err := p.describe(ctx, tablename)
+		if err != nil {
+			return nil, err
+		}
+		if description != nil && active(description) {
+			return description, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.clock.After(pollInterval):
+		}
+	}
+	return nil, fmt.Errorf("table [%s] did not become active after %v", tablename, maxPolls*pollInterval)
+}
+
+func active(description *types.TableDescription) bool {
+	if description.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range description.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+// keysOf describes a key schema as attribute names by key type, so schemas can be compared.
+func keysOf(elements []types.KeySchemaElement) map[types.KeyType]string {
+	keys := map[types.KeyType]string{}
+	for _, element := range elements {
+		keys[element.KeyType] = aws.ToString(element.AttributeName)
+	}
+	return keys
+}
+
+func sameProjection(a, b *types.Projection) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ProjectionType == b.ProjectionType && reflect.DeepEqual(a.NonKeyAttributes, b.NonKeyAttributes)
+}
@@ -0,0 +1,88 @@
+// Package tables declares the project's DynamoDB tables once, so they can be provisioned against DynamoDB Local or
+// any other endpoint and checked against the resources in serverless.yml.
+//
+// Every table is keyed on pk (HASH) and sk (RANGE) strings, is billed per request and may have global secondary
+// indexes and a TTL attribute.
+package tables
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+)
+
+// Schema is the declaration of one table.
+type Schema struct {
+	// Name is the table name in serverless.yml, used unless the EnvKey environment variable names another table.
+	Name         string
+	EnvKey       string
+	Indexes      []types.GlobalSecondaryIndex
+	TTLAttribute string
+}
+
+var (
+	Users = Schema{
+		Name:         "cmyk-users",
+		EnvKey:       ddb.UsersTableEnvKey,
+		TTLAttribute: "ttl",
+	}
+	Products = Schema{
+		Name:         "cmyk-products",
+		EnvKey:       ddb.ProductsTableEnvKey,
+		Indexes:      []types.GlobalSecondaryIndex{ddb.ColourBucketIndex},
+		TTLAttribute: "ttl",
+	}
+)
+
+// All is every table the project uses.
+var All = []Schema{Users, Products}
+
+// TableName is the value of the schema's environment variable, or its Name when that is not set.
+func (s Schema) TableName() string {
+	if tablename := os.Getenv(s.EnvKey); len(tablename) > 0 {
+		return tablename
+	}
+	return s.Name
+}
+
+func (s Schema) KeySchema() []types.KeySchemaElement {
+	return []types.KeySchemaElement{
+		{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+		{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+	}
+}
+
+// AttributeDefinitions declares every attribute used as a key of the table or one of its indexes, in the order
+// they are first used. All keys are strings.
+func (s Schema) AttributeDefinitions() []types.AttributeDefinition {
+	keys := s.KeySchema()
+	for _, index := range s.Indexes {
+		keys = append(keys, index.KeySchema...)
+	}
+
+	var definitions []types.AttributeDefinition
+	defined := map[string]bool{}
+	for _, key := range keys {
+		name := aws.ToString(key.AttributeName)
+		if defined[name] {
+			continue
+		}
+		defined[name] = true
+		definitions = append(definitions, types.AttributeDefinition{AttributeName: aws.String(name), AttributeType: types.ScalarAttributeTypeS})
+	}
+	return definitions
+}
+
+// CreateTableInput creates the table, with its indexes, as tablename. TTL is set separately by UpdateTimeToLive.
+func (s Schema) CreateTableInput(tablename string) *dynamodb.CreateTableInput {
+	return &dynamodb.CreateTableInput{
+		TableName:              aws.String(tablename),
+		BillingMode:            types.BillingModePayPerRequest,
+		KeySchema:              s.KeySchema(),
+		AttributeDefinitions:   s.AttributeDefinitions(),
+		GlobalSecondaryIndexes: s.Indexes,
+	}
+}
@@ -0,0 +1,270 @@
+package tables
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func newTestProvisioner() (*Provisioner, *ddb.InMemoryDynamoDB) {
+	clock := util.NewFixedClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := ddb.NewInMemoryDynamoDB(clock)
+	return NewProvisioner(client, clock), client
+}
+
+func TestEnsure_CreatesTheTableOnce(t *testing.T) {
+	ctx := context.TODO()
+	provisioner, client := newTestProvisioner()
+
+	changes, err := provisioner.Ensure(ctx, Products, "products")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Table: "products", Action: CreateTable},
+		{Table: "products", Action: EnableTTL, Name: "ttl"},
+	}, changes)
+
+	changes, err = provisioner.Ensure(ctx, Products, "products")
+	require.NoError(t, err)
+	assert.Empty(t, changes, "a table that matches its schema is left alone")
+
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("products")})
+	require.NoError(t, err)
+	require.Len(t, described.Table.GlobalSecondaryIndexes, 1)
+	assert.Equal(t, ddb.ColourBucketIndexName, aws.ToString(described.Table.GlobalSecondaryIndexes[0].IndexName))
+
+	// the table can be used by the repository straight away
+	repo := ddb.NewInstanceWithClient(client, "products")
+	_, err = ddb.NewProductsRepo(&repo, util.NewRealClock()).QueryColourBuckets(ctx, nil)
+	assert.NoError(t, err)
+}
+
+func TestEnsure_UpdatesIndexesAndTTL(t *testing.T) {
+	ctx := context.TODO()
+	provisioner, client := newTestProvisioner()
+
+	stale := types.GlobalSecondaryIndex{
+		IndexName:  aws.String("email-index"),
+		KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("email"), KeyType: types.KeyTypeHash}},
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+	}
+	client.CreatePkSkTable("products", "", stale)
+
+	changes, err := provisioner.Ensure(ctx, Products, "products")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Table: "products", Action: CreateIndex, Name: ddb.ColourBucketIndexName},
+		{Table: "products", Action: UndeclaredIndex, Name: "email-index"},
+		{Table: "products", Action: EnableTTL, Name: "ttl"},
+	}, changes)
+
+	described, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("products")})
+	require.NoError(t, err)
+	assert.Len(t, described.Table.GlobalSecondaryIndexes, 2, "an undeclared index is only reported")
+
+	changes, err = NewProvisioner(client, util.NewFixedClock(time.Now()), WithPrune()).Ensure(ctx, Products, "products")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Table: "products", Action: DeleteIndex, Name: "email-index"}}, changes)
+
+	noTTL := Users
+	noTTL.TTLAttribute = ""
+	client.CreatePkSkTable("users", "ttl")
+	changes, err = provisioner.Ensure(ctx, noTTL, "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Table: "users", Action: DisableTTL, Name: "ttl"}}, changes)
+}
+
+func TestEnsure_RejectsKeyChanges(t *testing.T) {
+	ctx := context.TODO()
+	provisioner, client := newTestProvisioner()
+
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("users"),
+		KeySchema: []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+	})
+	require.NoError(t, err)
+	_, err = provisioner.Ensure(ctx, Users, "users")
+	assert.ErrorContains(t, err, "must be deleted")
+
+	moved := ddb.ColourBucketIndex
+	moved.KeySchema = []types.KeySchemaElement{{AttributeName: aws.String("rgb"), KeyType: types.KeyTypeHash}}
+	client.CreatePkSkTable("products", "ttl", moved)
+	_, err = provisioner.Ensure(ctx, Products, "products")
+	assert.ErrorContains(t, err, "differs from the schema")
+}
+
+func TestEnsure_WaitsForTheTableToBecomeActive(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := &creatingClient{InMemoryDynamoDB: ddb.NewInMemoryDynamoDB(clock), creating: 2}
+	provisioner := NewProvisioner(client, clock)
+
+	done := make(chan error)
+	go func() {
+		_, err := provisioner.Ensure(ctx, Users, "users")
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		clock.WaitForTimers(1)
+		clock.Advance(pollInterval)
+	}
+	require.NoError(t, <-done)
+}
+
+// creatingClient reports a new table as CREATING for the first few times it is described.
+type creatingClient struct {
+	*ddb.InMemoryDynamoDB
+	mu       sync.Mutex
+	creating int
+}
+
+func (c *creatingClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	output, err := c.InMemoryDynamoDB.DescribeTable(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.creating > 0 {
+		c.creating--
+		output.Table.TableStatus = types.TableStatusCreating
+	}
+	return output, nil
+}
+
+func TestDelete_IsIdempotent(t *testing.T) {
+	ctx := context.TODO()
+	provisioner, client := newTestProvisioner()
+	client.CreatePkSkTable("users", "ttl")
+
+	changes, err := provisioner.Delete(ctx, "users")
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Table: "users", Action: DeleteTable}}, changes)
+
+	changes, err = provisioner.Delete(ctx, "users")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// serverlessTable is the part of an AWS::DynamoDB::Table resource that the schemas declare.
+type serverlessTable struct {
+	Type       string `yaml:"Type"`
+	Properties struct {
+		TableName               string `yaml:"TableName"`
+		BillingMode             string `yaml:"BillingMode"`
+		TimeToLiveSpecification struct {
+			AttributeName string `yaml:"AttributeName"`
+			Enabled       bool   `yaml:"Enabled"`
+		} `yaml:"TimeToLiveSpecification"`
+		KeySchema              []serverlessKey `yaml:"KeySchema"`
+		AttributeDefinitions   []serverlessKey `yaml:"AttributeDefinitions"`
+		GlobalSecondaryIndexes []struct {
+			IndexName  string          `yaml:"IndexName"`
+			KeySchema  []serverlessKey `yaml:"KeySchema"`
+			Projection struct {
+				ProjectionType string `yaml:"ProjectionType"`
+			} `yaml:"Projection"`
+		} `yaml:"GlobalSecondaryIndexes"`
+	} `yaml:"Properties"`
+}
+
+type serverlessKey struct {
+	AttributeName string `yaml:"AttributeName"`
+	KeyType       string `yaml:"KeyType"`
+	AttributeType string `yaml:"AttributeType"`
+}
+
+// TestSchemasMatchServerless diffs the schemas with the tables deployed by serverless.yml, so a change to one
+// cannot be forgotten in the other.
+func TestSchemasMatchServerless(t *testing.T) {
+	data, err := os.ReadFile("../../../serverless.yml")
+	require.NoError(t, err)
+
+	var config struct {
+		Resources struct {
+			Resources map[string]yaml.Node `yaml:"Resources"`
+		} `yaml:"resources"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &config))
+
+	deployed := map[string]serverlessTable{}
+	for _, node := range config.Resources.Resources {
+		var table serverlessTable
+		if err := node.Decode(&table); err != nil || table.Type != "AWS::DynamoDB::Table" {
+			continue
+		}
+		deployed[table.Properties.TableName] = table
+	}
+
+	var declared []string
+	for _, schema := range All {
+		declared = append(declared, schema.Name)
+	}
+	var names []string
+	for name := range deployed {
+		names = append(names, name)
+	}
+	sort.Strings(declared)
+	sort.Strings(names)
+	require.Equal(t, names, declared, "every table in serverless.yml should have a schema")
+
+	for _, schema := range All {
+		t.Run(schema.Name, func(t *testing.T) {
+			table := deployed[schema.Name].Properties
+			input := schema.CreateTableInput(schema.Name)
+
+			assert.Equal(t, string(input.BillingMode), table.BillingMode)
+			assert.Equal(t, schema.TTLAttribute, table.TimeToLiveSpecification.AttributeName)
+			assert.Equal(t, len(schema.TTLAttribute) > 0, table.TimeToLiveSpecification.Enabled)
+			assert.Equal(t, keysFromSchema(input.KeySchema), keysFromServerless(table.KeySchema))
+
+			attributes := map[string]string{}
+			for _, definition := range input.AttributeDefinitions {
+				attributes[aws.ToString(definition.AttributeName)] = string(definition.AttributeType)
+			}
+			deployedAttributes := map[string]string{}
+			for _, definition := range table.AttributeDefinitions {
+				deployedAttributes[definition.AttributeName] = definition.AttributeType
+			}
+			assert.Equal(t, attributes, deployedAttributes)
+
+			indexes := map[string][]string{}
+			for _, index := range input.GlobalSecondaryIndexes {
+				indexes[aws.ToString(index.IndexName)] = append(keysFromSchema(index.KeySchema), string(index.Projection.ProjectionType))
+			}
+			deployedIndexes := map[string][]string{}
+			for _, index := range table.GlobalSecondaryIndexes {
+				deployedIndexes[index.IndexName] = append(keysFromServerless(index.KeySchema), index.Projection.ProjectionType)
+			}
+			assert.Equal(t, indexes, deployedIndexes)
+		})
+	}
+}
+
+func keysFromSchema(elements []types.KeySchemaElement) []string {
+	var keys []string
+	for _, element := range elements {
+		keys = append(keys, string(element.KeyType)+":"+aws.ToString(element.AttributeName))
+	}
+	return keys
+}
+
+func keysFromServerless(elements []serverlessKey) []string {
+	var keys []string
+	for _, element := range elements {
+		keys = append(keys, element.KeyType+":"+element.AttributeName)
+	}
+	return keys
+}
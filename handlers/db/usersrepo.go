@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -11,28 +12,41 @@ import (
 	"github.com/projects/cmyk-api/handlers/model"
 	"github.com/projects/cmyk-api/handlers/util"
 	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type UsersRepo struct {
-	ddb   DynamoRepository
-	clock util.Clock
+	ddb    Repository
+	users  *DomainTable[userEntity, *model.User]
+	emails *Table[emailUniquenessEntity]
+	clock  util.Clock
 }
 
-func NewUsersTableRepo(ctx context.Context, region string) (*UsersRepo, error) {
-	instance, err := NewInstance(ctx, region, UsersTableEnvKey)
+func NewUsersTableRepo(ctx context.Context, region string, options ...DynamoDBOption) (*UsersRepo, error) {
+	instance, err := NewInstance(ctx, region, UsersTableEnvKey, options...)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewUsersRepo(instance, util.NewRealClock()), nil
+}
+
+// NewUsersRepo creates a UsersRepo over any Repository, such as one returned by NewInMemoryRepository.
+func NewUsersRepo(repository Repository, clock util.Clock) *UsersRepo {
 	return &UsersRepo{
-		ddb:   *instance,
-		clock: util.NewRealClock(),
-	}, nil
+		ddb:    repository,
+		users:  NewDomainTable[userEntity, *model.User](repository, PkSkKey("USERNAME"), userMapping),
+		emails: NewTable[emailUniquenessEntity](repository, emailKey),
+		clock:  clock,
+	}
 }
 
+// AddTestUser adds a user that DynamoDB expires once lifespan has passed. A None lifespan keeps the user.
 func (r *UsersRepo) AddTestUser(ctx context.Context, user model.User, lifespan model.Lifespan) (*model.User, error) {
-	ttlExpiry := model.TestLifespan(lifespan, time.Now())
+	user.MetaData.Lifespan = lifespan
+	ttlExpiry := model.TestLifespan(lifespan, r.clock.Now())
 	return r.addUser(ctx, user, &ttlExpiry)
 }
 
@@ -41,7 +55,16 @@ func (r *UsersRepo) AddUser(ctx context.Context, user model.User) (*model.User,
 }
 func (r *UsersRepo) addUser(ctx context.Context, user model.User, ttl *int64) (*model.User, error) {
 
+	// an empty email would otherwise claim the uniqueness item USEREMAIL# for every user without one
+	if err := validateModel("user", user); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("user", user.Id).Msg("rejected invalid user")
+		return nil, err
+	}
+
 	entity := createUserEntity(user, ttl)
+	if err := validateModel("user", entity); err != nil {
+		return nil, err
+	}
 	userEntity, err := attributevalue.MarshalMap(entity)
 	if err != nil {
 		return nil, err
@@ -49,28 +72,31 @@ func (r *UsersRepo) addUser(ctx context.Context, user model.User, ttl *int64) (*
 
 	// email entity sets pk and sk to the email which ensures uniqueness
 	// (needs to be region pinned to avoid consistency races)
-	emailEntity, err := attributevalue.MarshalMap(createEmailUniquenessEntity(user, ttl))
+	uniqueness := createEmailUniquenessEntity(user, ttl)
+	if err := validateModel("user email", uniqueness); err != nil {
+		return nil, err
+	}
+	emailEntity, err := attributevalue.MarshalMap(uniqueness)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := r.ddb.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{
-			{
-				Put: &types.Put{
-					Item:                userEntity,
-					TableName:           aws.String(r.ddb.Tablename),
-					ConditionExpression: aws.String("attribute_not_exists(pk)"),
-				},
+	err = r.ddb.TransactPut(ctx, []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				Item:                userEntity,
+				TableName:           aws.String(r.ddb.GetTablename()),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
 			},
-			{
-				Put: &types.Put{
-					Item:                emailEntity,
-					TableName:           aws.String(r.ddb.Tablename),
-					ConditionExpression: aws.String("attribute_not_exists(pk)"),
-				},
+		},
+		{
+			Put: &types.Put{
+				Item:                emailEntity,
+				TableName:           aws.String(r.ddb.GetTablename()),
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
 			},
-		}})
+		},
+	})
 
 	if err != nil {
 		var transactionCancelled *types.TransactionCanceledException
@@ -82,20 +108,24 @@ func (r *UsersRepo) addUser(ctx context.Context, user model.User, ttl *int64) (*
 		}
 	}
 
-	zerolog.Ctx(ctx).Info().Any("res", res).Msg("adding user to table response")
-
+	if errors.Is(err, ErrConditionFailed) {
+		return nil, NewAlreadyExistsError(fmt.Errorf("user [%s] or email [%s] already exists: %w", user.Id, NormaliseEmail(user.Email), err))
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	zerolog.Ctx(ctx).Info().Str("user", user.Id).Msg("added user to table")
+
 	return entity.ToUser()
 }
 
 func createEmailUniquenessEntity(user model.User, ttl *int64) emailUniquenessEntity {
 
 	entity := emailUniquenessEntity{
-		Pk: emailPk(user.Email),
-		Sk: emailPk(user.Email),
+		Pk:     emailPk(user.Email),
+		Sk:     emailPk(user.Email),
+		UserId: user.Id,
 	}
 
 	if ttl != nil && *ttl > 0 {
@@ -113,17 +143,40 @@ func createUserEntity(user model.User, ttl *int64) userEntity {
 		Sk:        usernamePK(user.Id),
 		Name:      user.Name,
 		CreatedAt: user.CreatedAt.Format(time.RFC3339),
+		Version:   user.Version,
+	}
+	// a new user starts at version 1, a user read from the table keeps its version
+	if entity.Version == 0 {
+		entity.Version = 1
+	}
+	if user.LastPasswordResetAt != nil {
+		entity.LastPasswordResetAt = user.LastPasswordResetAt.Format(time.RFC3339)
 	}
 
 	if ttl != nil && *ttl > 0 {
 		entity.ExpireAt = *ttl
+		entity.Lifespan = &user.MetaData.Lifespan
 	}
 
 	return entity
 }
 
-var usernamePK = func(email string) string { return pk("USERNAME", email) }
-var emailPk = func(email string) string { return pk("USEREMAIL", email) }
+var usernamePK = func(id string) string { return pk("USERNAME", id) }
+var emailPk = func(email string) string { return pk("USEREMAIL", NormaliseEmail(email)) }
+
+var emailKey = func(email string) map[string]types.AttributeValue { return PkSkKey("USEREMAIL")(NormaliseEmail(email)) }
+
+var userMapping = Mapping[userEntity, *model.User]{
+	ToDomain: func(entity userEntity) (*model.User, error) { return entity.ToUser() },
+	ToEntity: func(user *model.User) (userEntity, error) {
+		return createUserEntity(*user, user.MetaData.ExpiresAt), nil
+	},
+}
+
+// NormaliseEmail lower cases and trims an email so the uniqueness item cannot be sidestepped by changing case.
+func NormaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
 
 func pk(k, v string) string {
 	return spew.Sprintf("%s#%s", k, v)
@@ -131,26 +184,313 @@ func pk(k, v string) string {
 
 func (r *UsersRepo) GetUserByID(ctx context.Context, pk string) (*model.User, error) {
 
-	var entity userEntity
-	err := r.ddb.GetByKey(ctx, map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: usernamePK(pk)},
-		"sk": &types.AttributeValueMemberS{Value: usernamePK(pk)},
-	}, &entity)
+	return r.users.Get(ctx, pk)
+}
+
+// GetUsersByID reads many users at once, e.g. for admin views, in the order of ids. Unknown ids are skipped.
+func (r *UsersRepo) GetUsersByID(ctx context.Context, ids []string) ([]*model.User, error) {
+	return r.users.BatchGet(ctx, ids)
+}
+
+// GetUserByEmail resolves the email uniqueness item to its owning user id and then loads that user. Both reads
+// are strongly consistent so a user is visible by email as soon as AddUser returns.
+func (r *UsersRepo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+
+	entity, err := r.emails.GetConsistent(ctx, email)
+
+	var notFound NotFoundError
+	if errors.As(err, &notFound) {
+		return nil, NewNotFoundError(fmt.Errorf("user not found for email [%s]", NormaliseEmail(email)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entity.UserId) == 0 {
+		return nil, NewNotFoundError(fmt.Errorf("no user id recorded for email [%s]", NormaliseEmail(email)))
+	}
+
+	user, err := r.users.GetConsistent(ctx, entity.UserId)
+
+	if errors.As(err, &notFound) {
+		return nil, NewNotFoundError(fmt.Errorf("user [%s] not found for email [%s]", entity.UserId, NormaliseEmail(email)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangeEmail moves the user to a new email in a single transaction. The old email uniqueness item is deleted if
+// it still belongs to the user or, like the items written before userId was recorded, names no user. The new one
+// is created only if no other user owns it, and the user item is updated only if its version has not changed
+// since it was read. EmailAlreadyTakenError is returned when the new email belongs to another user, and a
+// ValidationError when it is not a valid email.
+func (r *UsersRepo) ChangeEmail(ctx context.Context, userID string, newEmail string) (*model.User, error) {
+
+	entity, err := r.users.Table.GetConsistent(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the new email is checked by the same rules as a new user's, in the form its uniqueness item is keyed by
+	newEmail = strings.TrimSpace(newEmail)
+	user, err := entity.ToUser()
+	if err != nil {
+		return nil, err
+	}
+	user.Email = NormaliseEmail(newEmail)
+	if err := validateModel("user", user); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("user", userID).Msg("rejected invalid email")
+		return nil, err
+	}
+
+	condition, values := entity.versionCondition()
+	values[":email"] = &types.AttributeValueMemberS{Value: newEmail}
+	values[":next"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(entity.Version+1, 10)}
+
+	updateUser := types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(r.ddb.GetTablename()),
+			Key:                       r.users.Key(userID),
+			UpdateExpression:          aws.String("SET email = :email, version = :next"),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeValues: values,
+		},
+	}
+
+	// a change of case only keeps the same uniqueness item so just the user item is updated
+	items := []types.TransactWriteItem{updateUser}
+	if emailPk(entity.Email) != emailPk(newEmail) {
+		var ttl *int64
+		if entity.ExpireAt > 0 {
+			ttl = &entity.ExpireAt
+		}
+
+		emailEntity, err := attributevalue.MarshalMap(createEmailUniquenessEntity(model.User{Id: userID, Email: newEmail}, ttl))
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items,
+			types.TransactWriteItem{
+				Put: &types.Put{
+					Item:                emailEntity,
+					TableName:           aws.String(r.ddb.GetTablename()),
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+			// the old email item may have been released and claimed by another user since the user was read
+			types.TransactWriteItem{
+				Delete: &types.Delete{
+					TableName:           aws.String(r.ddb.GetTablename()),
+					Key:                 r.emails.Key(entity.Email),
+					ConditionExpression: aws.String("attribute_not_exists(userId) OR userId = :userId"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":userId": &types.AttributeValueMemberS{Value: userID},
+					},
+				},
+			})
+	}
+
+	err = r.ddb.TransactPut(ctx, items)
 
+	var transactionCancelled *types.TransactionCanceledException
+	if errors.As(err, &transactionCancelled) {
+		reasons := transactionCancelled.CancellationReasons
+		if len(reasons) > 1 && isConditionalCheckFailedReason(reasons[1]) {
+			return nil, NewEmailAlreadyTakenError(newEmail, ExtractCancellationReasons(reasons))
+		}
+		if len(reasons) > 0 && isConditionalCheckFailedReason(reasons[0]) {
+			return nil, fmt.Errorf("user [%s] was modified concurrently: %w", userID, err)
+		}
+		if len(reasons) > 2 && isConditionalCheckFailedReason(reasons[2]) {
+			return nil, NewConditionFailedError(fmt.Errorf("email [%s] is not owned by user [%s]: %w", NormaliseEmail(entity.Email), userID, err),
+				ExtractCancellationReasons(reasons))
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	entity.Email = newEmail
+	entity.Version++
 	return entity.ToUser()
 }
 
+// UpdateProfile applies the fields set in update to the user's profile. The update is conditional on the version
+// read, so a concurrent change to the user fails with a ConditionFailedError rather than being overwritten, and
+// both the update and the resulting user must pass their validate tags. A user deleted since it was read is a
+// NotFoundError.
+func (r *UsersRepo) UpdateProfile(ctx context.Context, userID string, update model.ProfileUpdate) (*model.User, error) {
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		update.Name = &name
+	}
+	if err := validateModel("profile", update); err != nil {
+		return nil, err
+	}
+	if update.IsEmpty() {
+		return nil, NewValidationFailedError(fmt.Errorf("no profile fields to update for user [%s]", userID))
+	}
+
+	entity, err := r.users.Table.GetConsistent(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, values := entity.versionCondition()
+	values[":next"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(entity.Version+1, 10)}
+
+	if update.Name != nil {
+		entity.Name = *update.Name
+	}
+	entity.Version++
+	user, err := entity.ToUser()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateModel("user", user); err != nil {
+		return nil, err
+	}
+	values[":name"] = &types.AttributeValueMemberS{Value: entity.Name}
+
+	err = r.ddb.Update(ctx, &dynamodb.UpdateItemInput{
+		Key:                       r.users.Key(userID),
+		UpdateExpression:          aws.String("SET #name = :name, version = :next"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#name": "name"},
+		ExpressionAttributeValues: values,
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		// the user may have been deleted rather than changed since they were read
+		if _, getErr := r.users.Table.GetConsistent(ctx, userID); errors.Is(getErr, ErrNotFound) {
+			return nil, NewNotFoundError(fmt.Errorf("user [%s] not found", userID))
+		}
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("user", userID).Msg("failed to update profile")
+		return nil, err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("user", userID).Msg("updated profile")
+	return user, nil
+}
+
+// RecordPasswordReset sets when the user last reset their password. The version is bumped so an update that read
+// the user before the reset fails rather than being applied on top of it.
+func (r *UsersRepo) RecordPasswordReset(ctx context.Context, userID string, at time.Time) (*model.User, error) {
+
+	err := r.ddb.Update(ctx, &dynamodb.UpdateItemInput{
+		Key:                 r.users.Key(userID),
+		UpdateExpression:    aws.String("SET lastPasswordResetAt = :at ADD version :one"),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":at":  &types.AttributeValueMemberS{Value: at.UTC().Format(time.RFC3339)},
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return nil, NewNotFoundError(fmt.Errorf("user [%s] not found", userID))
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("user", userID).Msg("failed to record password reset")
+		return nil, err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("user", userID).Msg("recorded password reset")
+	return r.users.GetConsistent(ctx, userID)
+}
+
+// DeleteUser removes the user item and its email uniqueness item in one transaction so an account can be closed
+// without leaving an email that can never be registered again. The email item is only removed while it still
+// belongs to the user.
+func (r *UsersRepo) DeleteUser(ctx context.Context, userID string) error {
+
+	entity, err := r.users.Table.GetConsistent(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = r.ddb.TransactPut(ctx, []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName:           aws.String(r.ddb.GetTablename()),
+				Key:                 r.users.Key(userID),
+				ConditionExpression: aws.String("attribute_exists(pk)"),
+			},
+		},
+		{
+			Delete: &types.Delete{
+				TableName:           aws.String(r.ddb.GetTablename()),
+				Key:                 r.emails.Key(entity.Email),
+				ConditionExpression: aws.String("attribute_not_exists(userId) OR userId = :userId"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":userId": &types.AttributeValueMemberS{Value: userID},
+				},
+			},
+		},
+	})
+
+	var transactionCancelled *types.TransactionCanceledException
+	if errors.As(err, &transactionCancelled) {
+		reasons := transactionCancelled.CancellationReasons
+		if len(reasons) > 0 && isConditionalCheckFailedReason(reasons[0]) {
+			return NewNotFoundError(fmt.Errorf("user [%s] was deleted concurrently", userID))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	zerolog.Ctx(ctx).Info().Str("user", userID).Msg("deleted user from table")
+	return nil
+}
+
+func isConditionalCheckFailedReason(reason types.CancellationReason) bool {
+	return reason.Code != nil && *reason.Code == "ConditionalCheckFailed"
+}
+
+// EmailAlreadyTakenError is returned when an email uniqueness item is already owned by another user.
+type EmailAlreadyTakenError struct {
+	StatusCode int
+	Email      string
+	Reasons    string
+}
+
+func NewEmailAlreadyTakenError(email string, reasons string) EmailAlreadyTakenError {
+	return EmailAlreadyTakenError{
+		StatusCode: 409,
+		Email:      NormaliseEmail(email),
+		Reasons:    reasons,
+	}
+}
+
+func (e EmailAlreadyTakenError) Error() string {
+	return fmt.Sprintf("email [%s] is already taken: %s", e.Email, strings.TrimSpace(e.Reasons))
+}
+func (e EmailAlreadyTakenError) Is(target error) bool { return target == ErrAlreadyExists }
+
+// userEntity does not require a name because name is an optional attribute of the user pool.
 type userEntity struct {
 	Pk        string `dynamodbav:"pk" validate:"required"`
 	Sk        string `dynamodbav:"sk" validate:"required"`
 	CreatedAt string `dynamodbav:"createdAt" validate:"required"`
-	Email     string `dynamodbav:"email" validate:"required"`
-	Name      string `dynamodbav:"name" validate:"required"`
+	Email     string `dynamodbav:"email" validate:"required,email,max=254"`
+	Name      string `dynamodbav:"name" validate:"displayname"`
 	ExpireAt  int64  `dynamodbav:"ttl"`
+	Version   int64  `dynamodbav:"version"`
+	// Lifespan is only written for test users, alongside the ttl it set.
+	Lifespan *model.Lifespan `dynamodbav:"lifespan,omitempty"`
+	// LastPasswordResetAt is only written once the user has reset their password.
+	LastPasswordResetAt string `dynamodbav:"lastPasswordResetAt,omitempty"`
+}
+
+// versionCondition guards an update of the entity against concurrent writers.
+func (ue *userEntity) versionCondition() (string, map[string]types.AttributeValue) {
+	return versionCondition(ue.Version)
 }
 
 func (ue *userEntity) ToUser() (*model.User, error) {
@@ -160,16 +500,28 @@ func (ue *userEntity) ToUser() (*model.User, error) {
 	}
 
 	user := model.User{
-		Id:        ue.Pk,
+		Id:        strings.TrimPrefix(ue.Pk, usernamePK("")),
 		Name:      ue.Name,
 		Email:     ue.Email,
 		CreatedAt: timestamp,
+		Version:   ue.Version,
+	}
+
+	if len(ue.LastPasswordResetAt) > 0 {
+		resetAt, err := time.Parse(time.RFC3339, ue.LastPasswordResetAt)
+		if err != nil {
+			return nil, err
+		}
+		user.LastPasswordResetAt = &resetAt
 	}
 
 	if ue.ExpireAt > 0 {
 		user.MetaData.IsTest = true
 		user.MetaData.ExpiresAt = &ue.ExpireAt
 	}
+	if ue.Lifespan != nil {
+		user.MetaData.Lifespan = *ue.Lifespan
+	}
 
 	return &user, nil
 }
@@ -177,5 +529,6 @@ func (ue *userEntity) ToUser() (*model.User, error) {
 type emailUniquenessEntity struct {
 	Pk       string `dynamodbav:"pk" validate:"required"`
 	Sk       string `dynamodbav:"sk" validate:"required"`
+	UserId   string `dynamodbav:"userId" validate:"required"`
 	ExpireAt int64  `dynamodbav:"ttl"`
 }
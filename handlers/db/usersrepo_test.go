@@ -2,12 +2,17 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/joho/godotenv"
 	"github.com/projects/cmyk-api/handlers/model"
 	"github.com/projects/cmyk-api/handlers/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,12 +20,7 @@ import (
 func TestStoreAndRetrieveUser(t *testing.T) {
 
 	ctx := context.TODO()
-	err := godotenv.Load(fmt.Sprintf("../../.env.local"))
-	require.NoError(t, err)
-	region := requiredEnvironmentVariables(t)
-
-	repo, err := NewUsersTableRepo(ctx, region)
-	require.NoError(t, err)
+	repo := newTestUsersRepo(t)
 
 	now := time.Now()
 	u := util.RandomTestUser(util.WithCreatedAt(now))
@@ -30,6 +30,7 @@ func TestStoreAndRetrieveUser(t *testing.T) {
 	got, err := repo.GetUserByID(ctx, u.Id)
 	assert.NoError(t, err)
 
+	assert.Equal(t, u.Id, got.Id)
 	assert.Equal(t, savedUser.Id, got.Id)
 	assert.Equal(t, savedUser.Email, got.Email)
 	assert.Equal(t, savedUser.Name, got.Name)
@@ -37,8 +38,402 @@ func TestStoreAndRetrieveUser(t *testing.T) {
 	assert.Equal(t, *(savedUser.MetaData.ExpiresAt), *(got.MetaData.ExpiresAt))
 }
 
+// newTestUsersRepo returns a repo backed by the in-memory DynamoDB in short mode and by the table configured in
+// .env.local otherwise.
+func newTestUsersRepo(t *testing.T) *UsersRepo {
+	if testing.Short() {
+		return NewUsersRepo(NewInMemoryRepository(util.NewRealClock(), "cmyk-users"), util.NewRealClock())
+	}
+
+	err := godotenv.Load(fmt.Sprintf("../../.env.local"))
+	require.NoError(t, err)
+	region := requiredEnvironmentVariables(t)
+
+	repo, err := NewUsersTableRepo(context.TODO(), region)
+	require.NoError(t, err)
+	return repo
+}
+
 func requiredEnvironmentVariables(t *testing.T) string {
 	region := util.GetOSEnvOrFail(t, "AWS_REGION")
 	_ = util.GetOSEnvOrFail(t, "USERS_TABLE")
 	return region
 }
+
+func TestGetUserByEmail(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u := util.RandomTestUser(util.WithCreatedAt(time.Now()))
+	savedUser, err := repo.AddTestUser(ctx, u, model.Short)
+	require.NoError(t, err)
+
+	got, err := repo.GetUserByEmail(ctx, strings.ToUpper(u.Email))
+	require.NoError(t, err)
+	assert.Equal(t, u.Id, got.Id)
+	assert.Equal(t, savedUser.Email, got.Email)
+
+	_, err = repo.GetUserByEmail(ctx, "missing-"+u.Email)
+	var notFound NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestChangeEmail(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	oldEmail := u.Email
+	newEmail := "changed-" + u.Email
+
+	changed, err := repo.ChangeEmail(ctx, u.Id, newEmail)
+	require.NoError(t, err)
+	assert.Equal(t, newEmail, changed.Email)
+
+	got, err := repo.GetUserByEmail(ctx, newEmail)
+	require.NoError(t, err)
+	assert.Equal(t, u.Id, got.Id)
+	assert.Equal(t, newEmail, got.Email)
+
+	_, err = repo.GetUserByEmail(ctx, oldEmail)
+	var notFound NotFoundError
+	assert.True(t, errors.As(err, &notFound), "the old email should be released")
+}
+
+func TestChangeEmail_Validation(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	for _, email := range []string{"", "   ", "not-an-email", strings.Repeat("x", 250) + "@example.com"} {
+		_, err := repo.ChangeEmail(ctx, u.Id, email)
+		var invalid ValidationError
+		require.True(t, errors.As(err, &invalid), "email %q", email)
+		assert.Equal(t, "user", invalid.Model)
+	}
+
+	got, err := repo.GetUserByEmail(ctx, u.Email)
+	require.NoError(t, err)
+	assert.Equal(t, u.Id, got.Id, "a rejected email must not release the old one")
+}
+
+func TestChangeEmail_EmailOwnedByAnotherUser(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	first, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	second, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	_, err = repo.ChangeEmail(ctx, second.Id, first.Email)
+	var taken EmailAlreadyTakenError
+	require.True(t, errors.As(err, &taken))
+	assert.Equal(t, NormaliseEmail(first.Email), taken.Email)
+
+	got, err := repo.GetUserByEmail(ctx, second.Email)
+	require.NoError(t, err)
+	assert.Equal(t, second.Id, got.Id, "a failed change must leave the original email in place")
+}
+
+func TestChangeEmail_OldEmailOwnedByAnotherUser(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := NewUsersRepo(NewInMemoryRepository(util.NewRealClock(), "cmyk-users"), util.NewRealClock())
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	// the email item has been claimed by another user since it was written
+	claimed := createEmailUniquenessEntity(model.User{Id: "another-user", Email: u.Email}, nil)
+	require.NoError(t, repo.ddb.Put(ctx, claimed))
+
+	_, err = repo.ChangeEmail(ctx, u.Id, "changed-"+u.Email)
+	var conditionFailed ConditionFailedError
+	require.True(t, errors.As(err, &conditionFailed))
+
+	got, err := repo.emails.GetConsistent(ctx, u.Email)
+	require.NoError(t, err)
+	assert.Equal(t, "another-user", got.UserId, "another user's email item must not be deleted")
+	_, err = repo.GetUserByEmail(ctx, "changed-"+u.Email)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestChangeEmail_OldEmailWithoutUserId(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := NewUsersRepo(NewInMemoryRepository(util.NewRealClock(), "cmyk-users"), util.NewRealClock())
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	// email items written before they recorded their user have only a key
+	legacy := struct {
+		Pk string `dynamodbav:"pk"`
+		Sk string `dynamodbav:"sk"`
+	}{Pk: emailPk(u.Email), Sk: emailPk(u.Email)}
+	require.NoError(t, repo.ddb.Put(ctx, legacy))
+
+	newEmail := "changed-" + u.Email
+	_, err = repo.ChangeEmail(ctx, u.Id, newEmail)
+	require.NoError(t, err)
+
+	got, err := repo.GetUserByEmail(ctx, newEmail)
+	require.NoError(t, err)
+	assert.Equal(t, u.Id, got.Id)
+	_, err = repo.emails.GetConsistent(ctx, u.Email)
+	assert.True(t, errors.Is(err, ErrNotFound), "the old email should be released")
+}
+
+func TestUserMapping_PreservesVersion(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := NewUsersRepo(NewInMemoryRepository(util.NewRealClock(), "cmyk-users"), util.NewRealClock())
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, u.Version)
+	_, err = repo.RecordPasswordReset(ctx, u.Id, time.Now().UTC().Truncate(time.Second))
+	require.NoError(t, err)
+	changed, err := repo.ChangeEmail(ctx, u.Id, "changed-"+u.Email)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, changed.Version)
+
+	got, err := repo.GetUserByID(ctx, u.Id)
+	require.NoError(t, err)
+	require.NoError(t, repo.users.Put(ctx, got))
+
+	put, err := repo.GetUserByID(ctx, u.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, put.Version, "putting a user read from the table must not reset its version")
+	assert.Equal(t, got.LastPasswordResetAt, put.LastPasswordResetAt)
+}
+
+func TestDeleteUser(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteUser(ctx, u.Id))
+
+	var notFound NotFoundError
+	_, err = repo.GetUserByID(ctx, u.Id)
+	assert.True(t, errors.As(err, &notFound))
+	_, err = repo.GetUserByEmail(ctx, u.Email)
+	assert.True(t, errors.As(err, &notFound))
+
+	// the email is free to be registered again
+	_, err = repo.AddTestUser(ctx, util.RandomTestUser(func(user model.User) model.User {
+		user.Email = u.Email
+		user.CreatedAt = time.Now()
+		return user
+	}), model.Short)
+	assert.NoError(t, err)
+
+	err = repo.DeleteUser(ctx, u.Id)
+	assert.True(t, errors.As(err, &notFound))
+}
+
+func TestGetUsersByID(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	first, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	second, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	users, err := repo.GetUsersByID(ctx, []string{second.Id, "unknown", first.Id})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, second.Id, users[0].Id)
+	assert.Equal(t, first.Id, users[1].Id)
+}
+
+func TestUpdateProfile(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	name := "  Cerulean Fan  "
+	updated, err := repo.UpdateProfile(ctx, u.Id, model.ProfileUpdate{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "Cerulean Fan", updated.Name)
+	assert.Equal(t, u.Email, updated.Email)
+	assert.EqualValues(t, 2, updated.Version)
+
+	got, err := repo.GetUserByID(ctx, u.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "Cerulean Fan", got.Name)
+	assert.Equal(t, got.Version, updated.Version, "the returned user matches the one stored")
+
+	// the version moved on, so a second update has to read it again rather than reuse the first condition
+	again := "Magenta Fan"
+	updated, err = repo.UpdateProfile(ctx, u.Id, model.ProfileUpdate{Name: &again})
+	require.NoError(t, err)
+	assert.Equal(t, again, updated.Name)
+	assert.EqualValues(t, 3, updated.Version)
+}
+
+func TestUpdateProfile_Validation(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	for name, update := range map[string]model.ProfileUpdate{
+		"blank name":    {Name: aws.String("   ")},
+		"long name":     {Name: aws.String(strings.Repeat("x", model.MaxNameLength+1))},
+		"nothing to do": {},
+	} {
+		_, err := repo.UpdateProfile(ctx, u.Id, update)
+		assert.True(t, errors.Is(err, ErrValidationFailed), name)
+	}
+
+	got, err := repo.GetUserByID(ctx, u.Id)
+	require.NoError(t, err)
+	assert.Equal(t, u.Name, got.Name, "a rejected update must not be written")
+
+	_, err = repo.UpdateProfile(ctx, "missing", model.ProfileUpdate{Name: aws.String("someone")})
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// a name a user can sign up with can also be set on their profile
+	long := strings.Repeat("x", model.MaxNameLength)
+	updated, err := repo.UpdateProfile(ctx, u.Id, model.ProfileUpdate{Name: &long})
+	require.NoError(t, err)
+	assert.Equal(t, long, updated.Name)
+}
+
+// deleteBeforeUpdate deletes the item an update is for just before applying it, as a concurrent delete would.
+type deleteBeforeUpdate struct {
+	Repository
+}
+
+func (r deleteBeforeUpdate) Update(ctx context.Context, input *dynamodb.UpdateItemInput) error {
+	if err := r.Repository.Delete(ctx, input.Key); err != nil {
+		return err
+	}
+	return r.Repository.Update(ctx, input)
+}
+
+func TestUpdateProfile_DeletedSinceRead(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewRealClock()
+	table := NewInMemoryRepository(clock, "cmyk-users")
+	repo := NewUsersRepo(deleteBeforeUpdate{table}, clock)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+
+	_, err = repo.UpdateProfile(ctx, u.Id, model.ProfileUpdate{Name: aws.String("someone")})
+	assert.True(t, errors.Is(err, ErrNotFound), "got %v", err)
+}
+
+func TestAddUser_Validation(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u := util.RandomTestUser(util.WithCreatedAt(time.Now()))
+	u.Email = "not-an-email"
+	u.Name = strings.Repeat("x", 129)
+
+	_, err := repo.AddTestUser(ctx, u, model.Short)
+	require.True(t, errors.Is(err, ErrValidationFailed))
+
+	var invalid ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, 400, StatusCode(err))
+	assert.Equal(t, "user", invalid.Model)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "email", Rule: "email"},
+		{Field: "name", Rule: "max", Param: "128"},
+	}, invalid.Fields)
+
+	_, err = repo.GetUserByID(ctx, u.Id)
+	assert.True(t, errors.Is(err, ErrNotFound), "a rejected user must not be written")
+
+	u.Email = ""
+	u.Name = ""
+	_, err = repo.AddTestUser(ctx, u, model.Short)
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []FieldError{{Field: "email", Rule: "required"}}, invalid.Fields)
+	assert.EqualError(t, err, "invalid user: email is required")
+}
+
+func TestRecordPasswordReset(t *testing.T) {
+
+	ctx := context.TODO()
+	repo := newTestUsersRepo(t)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	assert.Nil(t, u.LastPasswordResetAt)
+
+	resetAt := time.Now().UTC().Truncate(time.Second)
+	updated, err := repo.RecordPasswordReset(ctx, u.Id, resetAt)
+	require.NoError(t, err)
+	require.NotNil(t, updated.LastPasswordResetAt)
+	assert.EqualValues(t, resetAt, *updated.LastPasswordResetAt)
+
+	_, err = repo.RecordPasswordReset(ctx, "missing", resetAt)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestAddTestUser_ExpiresAfterLifespan(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	table := NewInMemoryRepository(clock, "cmyk-users")
+	repo := NewUsersRepo(table, clock)
+
+	// the ttl is taken from the repository's clock rather than the time the user was created
+	clock.Advance(time.Hour)
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(time.Now())), model.Short)
+	require.NoError(t, err)
+	expiresAt := clock.Now().Add(24 * time.Hour).Unix()
+	require.NotNil(t, u.MetaData.ExpiresAt)
+	assert.Equal(t, expiresAt, *u.MetaData.ExpiresAt)
+	assert.Equal(t, model.Short, u.MetaData.Lifespan)
+
+	// DynamoDB deletes expired items in its own time, so only the ttl it is given can be checked
+	for _, key := range []map[string]types.AttributeValue{PkSkKey("USERNAME")(u.Id), emailKey(u.Email)} {
+		var stored struct {
+			ExpireAt int64 `dynamodbav:"ttl"`
+		}
+		require.NoError(t, table.GetByKey(ctx, key, &stored))
+		assert.Equal(t, expiresAt, stored.ExpireAt)
+	}
+}
+
+func TestAddTestUser_NoneIsKept(t *testing.T) {
+
+	ctx := context.TODO()
+	clock := util.NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	repo := NewUsersRepo(NewInMemoryRepository(clock, "cmyk-users"), clock)
+
+	u, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())), model.None)
+	require.NoError(t, err)
+	assert.Nil(t, u.MetaData.ExpiresAt)
+
+	clock.Advance(365 * 24 * time.Hour)
+	_, err = repo.GetUserByID(ctx, u.Id)
+	assert.NoError(t, err, "a user with no lifespan is never expired")
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/projects/cmyk-api/handlers/model"
+)
+
+// validate checks the validate struct tags of models and entities. It caches struct metadata so is shared.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// report fields by the name clients and the table know them by rather than the Go field name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "dynamodbav"} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if len(name) > 0 {
+				return name
+			}
+		}
+		return field.Name
+	})
+	v.RegisterAlias("displayname", fmt.Sprintf("max=%d", model.MaxNameLength))
+	return v
+}
+
+// FieldError is a field that broke one of its validate rules. Param is the rule's argument, such as the length
+// for max.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+func (f FieldError) String() string {
+	switch f.Rule {
+	case "required":
+		return fmt.Sprintf("%s is required", f.Field)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email", f.Field)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", f.Field, f.Param)
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", f.Field, f.Param)
+	}
+	return fmt.Sprintf("%s failed %s", f.Field, f.Rule)
+}
+
+// ValidationError lists every field of a model that failed validation, so a client can report them all at once.
+// It matches ErrValidationFailed like ValidationFailedError.
+type ValidationError struct {
+	StatusCode int
+	Model      string
+	Fields     []FieldError
+}
+
+func NewValidationError(model string, fields ...FieldError) ValidationError {
+	return ValidationError{
+		StatusCode: 400,
+		Model:      model,
+		Fields:     fields,
+	}
+}
+
+func (m ValidationError) Error() string {
+	failures := make([]string, 0, len(m.Fields))
+	for _, field := range m.Fields {
+		failures = append(failures, field.String())
+	}
+	return fmt.Sprintf("invalid %s: %s", m.Model, strings.Join(failures, ", "))
+}
+func (m ValidationError) Is(target error) bool { return target == ErrValidationFailed }
+
+// validateModel checks the validate tags of v, a struct or pointer to one, returning a ValidationError naming
+// the model when any fail. Repositories call it on the models they are given and the entities they write.
+func validateModel(model string, v interface{}) error {
+	err := validate.Struct(v)
+
+	var failures validator.ValidationErrors
+	if errors.As(err, &failures) {
+		fields := make([]FieldError, 0, len(failures))
+		for _, failure := range failures {
+			// the namespace starts with the struct name, which the model name replaces
+			namespace := failure.Namespace()
+			if i := strings.Index(namespace, "."); i >= 0 {
+				namespace = namespace[i+1:]
+			}
+			// the actual tag reports an alias such as displayname by the rule it stands for
+			fields = append(fields, FieldError{Field: namespace, Rule: failure.ActualTag(), Param: failure.Param()})
+		}
+		return NewValidationError(model, fields...)
+	}
+	return err
+}
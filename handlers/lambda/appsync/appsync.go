@@ -0,0 +1,81 @@
+// Package appsync holds what the AppSync direct lambda resolvers share: reading the caller and turning errors into
+// GraphQL errors.
+package appsync
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/rs/zerolog"
+)
+
+// ErrUnauthorized is returned when a resolver is invoked without a Cognito identity.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// The errorType of the GraphQL errors resolvers return, so clients can branch on them.
+const (
+	NotFound         = "NotFound"
+	AlreadyExists    = "AlreadyExists"
+	ConditionFailed  = "ConditionFailed"
+	Throttled        = "Throttled"
+	ValidationFailed = "ValidationFailed"
+	Unauthorized     = "Unauthorized"
+	InternalFailure  = "InternalFailure"
+)
+
+// CallerSub returns the Cognito sub of the user making the request.
+func CallerSub(identity *events.AppSyncCognitoIdentity) (string, error) {
+	if identity == nil || len(identity.Sub) == 0 {
+		return "", ErrUnauthorized
+	}
+	return identity.Sub, nil
+}
+
+// GraphQLError converts err into the error AppSync reports in the errors of the response, with the errorType set
+// from the repository error taxonomy. The lambda runtime only passes the type through when the handler returns
+// this value unwrapped. Only validation and authorization messages reach the client, as they describe its request;
+// the others can carry table keys and internal detail, so they are logged and replaced by a fixed message naming
+// the resource, such as "profile not found".
+func GraphQLError(ctx context.Context, resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return messages.InvokeResponse_Error{Type: Unauthorized, Message: err.Error()}
+	case ddb.StatusCode(err) == 400:
+		return messages.InvokeResponse_Error{Type: ValidationFailed, Message: err.Error()}
+	}
+
+	errorType, message := InternalFailure, "internal error"
+	switch ddb.StatusCode(err) {
+	case 404:
+		errorType, message = NotFound, resource+" not found"
+	case 409:
+		errorType, message = AlreadyExists, resource+" already exists"
+	case 412:
+		errorType, message = ConditionFailed, resource+" was changed by another request"
+	case 429:
+		errorType, message = Throttled, "too many requests"
+	}
+
+	logEvent := zerolog.Ctx(ctx).Warn()
+	if errorType == InternalFailure {
+		logEvent = zerolog.Ctx(ctx).Error()
+	}
+	logEvent.Err(err).Str("errorType", errorType).Str("resource", resource).Msg("resolver failed")
+	return messages.InvokeResponse_Error{Type: errorType, Message: message}
+}
+
+// ErrorType returns the errorType of an error returned by GraphQLError, or an empty string for any other error.
+func ErrorType(err error) string {
+	var graphQLError messages.InvokeResponse_Error
+	if errors.As(err, &graphQLError) {
+		return graphQLError.Type
+	}
+	return ""
+}
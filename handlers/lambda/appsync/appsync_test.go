@@ -0,0 +1,59 @@
+package appsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLError(t *testing.T) {
+	tests := []struct {
+		err       error
+		errorType string
+		message   string
+	}{
+		{ddb.NewNotFoundError(errors.New("user [1] not found")), NotFound, "profile not found"},
+		{ddb.NewAlreadyExistsError(errors.New("exists")), AlreadyExists, "profile already exists"},
+		{ddb.NewConditionFailedError(errors.New("version [3]"), ""), ConditionFailed, "profile was changed by another request"},
+		{ddb.NewValidationFailedError(errors.New("bad")), ValidationFailed, "bad"},
+		{ddb.NewThrottledError(errors.New("slow down")), Throttled, "too many requests"},
+		{fmt.Errorf("reading profile: %w", ErrUnauthorized), Unauthorized, "reading profile: unauthorized"},
+		{errors.New("connection reset"), InternalFailure, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.errorType, func(t *testing.T) {
+			err := GraphQLError(context.TODO(), "profile", tt.err)
+
+			var invokeError messages.InvokeResponse_Error
+			require.True(t, errors.As(err, &invokeError), "the lambda runtime only keeps the type of an InvokeResponse_Error")
+			assert.Equal(t, tt.errorType, invokeError.Type)
+			assert.Equal(t, tt.message, invokeError.Message)
+			assert.Equal(t, tt.errorType, ErrorType(err))
+		})
+	}
+
+	// the keys in a repository error must not reach the client
+	var notFound messages.InvokeResponse_Error
+	err := ddb.NewNotFoundError(fmt.Errorf("item with key [pk: secret-key] not found"))
+	require.True(t, errors.As(GraphQLError(context.TODO(), "product", err), &notFound))
+	assert.NotContains(t, notFound.Message, "secret-key")
+	assert.Nil(t, GraphQLError(context.TODO(), "profile", nil))
+}
+
+func TestCallerSub(t *testing.T) {
+	sub, err := CallerSub(&events.AppSyncCognitoIdentity{Sub: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", sub)
+
+	_, err = CallerSub(nil)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	_, err = CallerSub(&events.AppSyncCognitoIdentity{})
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+}
@@ -0,0 +1,93 @@
+package close_user_account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// CloseUserAccountRequest is the payload an administrator (or an automated GDPR workflow) invokes the lambda with.
+type CloseUserAccountRequest struct {
+	UserID      string `json:"userId"`
+	RequestedBy string `json:"requestedBy"`
+}
+
+type CloseUserAccountResponse struct {
+	UserID         string    `json:"userId"`
+	ClosedAt       time.Time `json:"closedAt"`
+	AlreadyDeleted bool      `json:"alreadyDeleted"`
+}
+
+type CloseUserAccountFn func(ctx context.Context, request CloseUserAccountRequest) (CloseUserAccountResponse, error)
+type closeUserAccountHandler struct {
+	clock     util.Clock
+	logger    zerolog.Logger
+	usersRepo ddb.UsersRepo
+}
+
+// Handler deletes the user's data. Deletion requests may be retried, so a user that no longer exists is
+// reported as already deleted rather than failing.
+func (h *closeUserAccountHandler) Handler(ctx context.Context, request CloseUserAccountRequest) (CloseUserAccountResponse, error) {
+
+	logger := h.logger.With().
+		Str("handler", "close-user-account").
+		Str("userId", request.UserID).
+		Str("requestedBy", request.RequestedBy).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	if len(request.UserID) == 0 {
+		return CloseUserAccountResponse{}, errors.New("userId is required to close an account")
+	}
+
+	response := CloseUserAccountResponse{
+		UserID:   request.UserID,
+		ClosedAt: h.clock.Now(),
+	}
+
+	err := h.usersRepo.DeleteUser(ctx, request.UserID)
+
+	var notFound ddb.NotFoundError
+	if errors.As(err, &notFound) {
+		logger.Info().Msg("user already deleted")
+		response.AlreadyDeleted = true
+		return response, nil
+	}
+	if err != nil {
+		logger.Err(err).Msg("error closing user account")
+		return CloseUserAccountResponse{}, err
+	}
+
+	logger.Info().Msg("closed user account")
+	return response, nil
+}
+
+type CloseUserAccountHandlerOption = func(handler *closeUserAccountHandler) *closeUserAccountHandler
+
+func WithLogger(logger zerolog.Logger) CloseUserAccountHandlerOption {
+	return func(h *closeUserAccountHandler) *closeUserAccountHandler {
+		return &closeUserAccountHandler{
+			clock:     h.clock,
+			logger:    logger,
+			usersRepo: h.usersRepo,
+		}
+	}
+}
+
+func NewCloseUserAccountHandler(clock util.Clock, usersRepo ddb.UsersRepo, options ...CloseUserAccountHandlerOption) CloseUserAccountFn {
+	h := &closeUserAccountHandler{
+		clock:     clock,
+		logger:    zerolog.Nop(),
+		usersRepo: usersRepo,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler
+}
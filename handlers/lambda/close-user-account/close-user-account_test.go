@@ -0,0 +1,41 @@
+package close_user_account
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseUserAccount(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Now())
+	repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+	handler := NewCloseUserAccountHandler(clock, *repo, WithLogger(util.NewDevLogger(zerolog.TraceLevel)))
+
+	user, err := repo.AddTestUser(ctx, util.RandomTestUser(util.WithCreatedAt(clock.Now())), model.Short)
+	require.NoError(t, err)
+
+	response, err := handler(ctx, CloseUserAccountRequest{UserID: user.Id, RequestedBy: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, user.Id, response.UserID)
+	assert.False(t, response.AlreadyDeleted)
+
+	_, err = repo.GetUserByID(ctx, user.Id)
+	var notFound ddb.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+
+	retried, err := handler(ctx, CloseUserAccountRequest{UserID: user.Id, RequestedBy: "admin"})
+	require.NoError(t, err)
+	assert.True(t, retried.AlreadyDeleted, "a retried request should succeed")
+
+	_, err = handler(ctx, CloseUserAccountRequest{})
+	assert.Error(t, err)
+}
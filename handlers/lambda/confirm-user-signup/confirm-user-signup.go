@@ -2,6 +2,8 @@ package confirm_user_signup
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	ddb "github.com/projects/cmyk-api/handlers/db"
 	"github.com/projects/cmyk-api/handlers/model"
@@ -17,36 +19,93 @@ type cognitoPostSignUpHandler struct {
 	usersRepo ddb.UsersRepo
 }
 
-func (h *cognitoPostSignUpHandler) Handler(ctx context.Context, event events.CognitoEventUserPoolsPostConfirmation) (events.CognitoEventUserPoolsPostConfirmation, error) {
+const (
+	TriggerConfirmSignUp         = "PostConfirmation_ConfirmSignUp"
+	TriggerConfirmForgotPassword = "PostConfirmation_ConfirmForgotPassword"
+)
+
+type triggerRoute = func(h *cognitoPostSignUpHandler, ctx context.Context, logger zerolog.Logger, event events.CognitoEventUserPoolsPostConfirmation) error
 
-	logger := h.logger
-	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-		return c.Str("handler", "confirm-user-signup")
-	})
+// routes dispatches events by trigger source, which is matched case-insensitively. Sources without a route are
+// recorded in the log and otherwise ignored, so adding a trigger to the user pool cannot break it.
+var routes = map[string]triggerRoute{
+	strings.ToLower(TriggerConfirmSignUp):         (*cognitoPostSignUpHandler).confirmSignUp,
+	strings.ToLower(TriggerConfirmForgotPassword): (*cognitoPostSignUpHandler).confirmForgotPassword,
+}
 
-	logger.WithContext(ctx) // add the logger to ctx so we can retrieve it
-	logger.Info().Msg("handling PostConfirmation_Confirm_SignUp event")
+func (h *cognitoPostSignUpHandler) Handler(ctx context.Context, event events.CognitoEventUserPoolsPostConfirmation) (events.CognitoEventUserPoolsPostConfirmation, error) {
 
-	if strings.EqualFold(event.TriggerSource, "PostConfirmation_ConfirmSignUp") {
-		_, err := h.usersRepo.AddUser(ctx, model.User{
-			Id:        event.Request.UserAttributes["sub"],
-			Email:     event.Request.UserAttributes["email"],
-			Name:      event.Request.UserAttributes["name"],
-			CreatedAt: h.clock.Now(),
-		})
+	logger := h.logger.With().
+		Str("handler", "confirm-user-signup").
+		Str("triggerSource", event.TriggerSource).
+		Str("user", event.UserName).
+		Logger()
 
-		if err != nil {
-			logger.Err(err).Msg("error processing PostConfirmation_Confirm_SignUp")
-		}
+	ctx = logger.WithContext(ctx) // add the logger to ctx so we can retrieve it
 
+	route, ok := routes[strings.ToLower(event.TriggerSource)]
+	if !ok {
+		logger.Info().Msg("recorded event with no route for its trigger source")
+		return event, nil
+	}
+
+	logger.Info().Msg("handling PostConfirmation event")
+	if err := route(h, ctx, logger, event); err != nil {
+		logger.Err(err).Msg("error processing PostConfirmation event")
 		return event, err
-	} else {
-		logger.Debug().Str("TriggerSource", event.TriggerSource).Msg("event is noop for handler")
 	}
 
 	return event, nil
 }
 
+func (h *cognitoPostSignUpHandler) confirmSignUp(ctx context.Context, logger zerolog.Logger, event events.CognitoEventUserPoolsPostConfirmation) error {
+
+	user := model.User{
+		Id:        event.Request.UserAttributes["sub"],
+		Email:     event.Request.UserAttributes["email"],
+		Name:      event.Request.UserAttributes["name"],
+		CreatedAt: h.clock.Now(),
+	}
+	_, err := h.usersRepo.AddUser(ctx, user)
+	if errors.Is(err, ddb.ErrAlreadyExists) {
+		return h.alreadyCreated(ctx, logger, user, err)
+	}
+	return err
+}
+
+// confirmForgotPassword records the reset against the user. The password has already been changed in the user
+// pool, so a user missing from the table is logged rather than failing the confirmation.
+func (h *cognitoPostSignUpHandler) confirmForgotPassword(ctx context.Context, logger zerolog.Logger, event events.CognitoEventUserPoolsPostConfirmation) error {
+
+	_, err := h.usersRepo.RecordPasswordReset(ctx, event.Request.UserAttributes["sub"], h.clock.Now())
+	if errors.Is(err, ddb.ErrNotFound) {
+		logger.Warn().Err(err).Msg("password reset for a user that is not in the table")
+		return nil
+	}
+	return err
+}
+
+// alreadyCreated decides whether a signup that failed because the user or email exists is a retry. Cognito retries
+// PostConfirmation when the trigger errors or times out, so the user may have been written by an earlier attempt,
+// and failing the retry would fail the user's confirmation. The signup succeeds when the email is owned by the
+// same user, and fails with EmailAlreadyTakenError when another user owns it.
+func (h *cognitoPostSignUpHandler) alreadyCreated(ctx context.Context, logger zerolog.Logger, user model.User, err error) error {
+
+	owner, lookupErr := h.usersRepo.GetUserByEmail(ctx, user.Email)
+	if lookupErr != nil {
+		// the user id is taken but not with this email, so this is not a retry of the same signup
+		logger.Err(lookupErr).Str("user", user.Id).Msg("could not find the owner of an existing signup")
+		return err
+	}
+
+	if owner.Id != user.Id {
+		return ddb.NewEmailAlreadyTakenError(user.Email, fmt.Sprintf("owned by user [%s]", owner.Id))
+	}
+
+	logger.Info().Str("user", user.Id).Msg("user already created by an earlier attempt, treating retry as success")
+	return nil
+}
+
 type CognitoPostSignUpHandlerOption = func(handler *cognitoPostSignUpHandler) *cognitoPostSignUpHandler
 
 func WithLogger(logger zerolog.Logger) CognitoPostSignUpHandlerOption {
@@ -21,6 +21,131 @@ import (
 	"time"
 )
 
+func TestCognitoPostSignUp(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Now().UTC().Truncate(time.Second))
+	repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+	handler := NewCognitoPostSignUpHandler(clock, *repo, WithLogger(util.NewDevLogger(zerolog.TraceLevel)))
+	user := util.RandomTestUser()
+
+	_, err := handler(ctx, *createCognitoPostSignUpEvent(user, "local", "local-user-pool"))
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.EqualValues(t, user.Id, found.Id)
+	assert.EqualValues(t, user.Email, found.Email)
+	assert.EqualValues(t, user.Name, found.Name)
+	assert.EqualValues(t, clock.Now(), found.CreatedAt)
+}
+
+func TestCognitoPostSignUp_Retried(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Now().UTC().Truncate(time.Second))
+	repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+	handler := NewCognitoPostSignUpHandler(clock, *repo, WithLogger(util.NewDevLogger(zerolog.TraceLevel)))
+	user := util.RandomTestUser()
+	event := *createCognitoPostSignUpEvent(user, "local", "local-user-pool")
+
+	_, err := handler(ctx, event)
+	require.NoError(t, err)
+
+	_, err = handler(ctx, event)
+	require.NoError(t, err, "a retry of the same signup must succeed")
+
+	found, err := repo.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.EqualValues(t, user.Id, found.Id)
+	assert.EqualValues(t, clock.Now(), found.CreatedAt)
+}
+
+func TestCognitoPostSignUp_EmailOwnedByAnotherUser(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Now().UTC().Truncate(time.Second))
+	repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+	handler := NewCognitoPostSignUpHandler(clock, *repo, WithLogger(util.NewDevLogger(zerolog.TraceLevel)))
+	first := util.RandomTestUser()
+	second := util.RandomTestUser(util.WithEmail(first.Email))
+
+	_, err := handler(ctx, *createCognitoPostSignUpEvent(first, "local", "local-user-pool"))
+	require.NoError(t, err)
+
+	_, err = handler(ctx, *createCognitoPostSignUpEvent(second, "local", "local-user-pool"))
+	var taken ddb.EmailAlreadyTakenError
+	require.True(t, errors.As(err, &taken))
+	assert.True(t, errors.Is(err, ddb.ErrAlreadyExists))
+
+	owner, err := repo.GetUserByEmail(ctx, first.Email)
+	require.NoError(t, err)
+	assert.EqualValues(t, first.Id, owner.Id)
+
+	_, err = repo.GetUserByID(ctx, second.Id)
+	assert.True(t, errors.Is(err, ddb.ErrNotFound), "the second user must not be written")
+}
+
+func TestCognitoPostConfirmation_Routes(t *testing.T) {
+	ctx := context.TODO()
+	signedUpAt := time.Now().UTC().Truncate(time.Second)
+
+	type outcome struct {
+		created bool
+		resetAt bool
+	}
+	for triggerSource, want := range map[string]outcome{
+		TriggerConfirmSignUp:               {created: true},
+		"postconfirmation_confirmsignup":   {created: true},
+		TriggerConfirmForgotPassword:       {resetAt: true},
+		"PostConfirmation_AdminCreateUser": {},
+		"PreSignUp_SignUp":                 {},
+	} {
+		t.Run(triggerSource, func(t *testing.T) {
+			clock := util.NewFixedClock(signedUpAt)
+			repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+			existing, err := repo.AddUser(ctx, util.RandomTestUser(util.WithCreatedAt(signedUpAt)))
+			require.NoError(t, err)
+			user := util.RandomTestUser()
+			if triggerSource == TriggerConfirmForgotPassword {
+				user = *existing
+			}
+
+			// the event arrives an hour after the existing user signed up
+			resetAt := signedUpAt.Add(time.Hour)
+			var logs bytes.Buffer
+			handler := NewCognitoPostSignUpHandler(util.NewFixedClock(resetAt), *repo, WithLogger(zerolog.New(&logs)))
+
+			_, err = handler(ctx, *createCognitoPostConfirmationEvent(user, triggerSource, "local", "local-user-pool"))
+			require.NoError(t, err)
+			assert.Contains(t, logs.String(), triggerSource, "every event is recorded with its trigger source")
+
+			found, err := repo.GetUserByID(ctx, user.Id)
+			if !want.created && !want.resetAt {
+				assert.True(t, errors.Is(err, ddb.ErrNotFound), "unrouted events must not write users")
+				return
+			}
+			require.NoError(t, err)
+			if want.created {
+				assert.EqualValues(t, resetAt, found.CreatedAt)
+				assert.Nil(t, found.LastPasswordResetAt)
+			}
+			if want.resetAt {
+				assert.EqualValues(t, signedUpAt, found.CreatedAt)
+				require.NotNil(t, found.LastPasswordResetAt)
+				assert.EqualValues(t, resetAt, *found.LastPasswordResetAt)
+			}
+		})
+	}
+}
+
+func TestCognitoPostConfirmation_ForgotPasswordForUnknownUser(t *testing.T) {
+	ctx := context.TODO()
+	clock := util.NewFixedClock(time.Now().UTC().Truncate(time.Second))
+	repo := ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+	handler := NewCognitoPostSignUpHandler(clock, *repo, WithLogger(util.NewDevLogger(zerolog.TraceLevel)))
+
+	_, err := handler(ctx, *createCognitoPostConfirmationEvent(util.RandomTestUser(), TriggerConfirmForgotPassword, "local", "local-user-pool"))
+	assert.NoError(t, err, "the password has already been reset so the confirmation must not fail")
+}
+
 func TestCognitoPostSignUp_Integration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode.")
@@ -75,8 +200,8 @@ func lookupUserInDynamoDB(email string) (*model.User, error) {
 	var foundUser *model.User
 
 	retryable := func() error {
-		foundUser, err = repo.GetUserByID(ctx, email)
-		if len(foundUser.Id) == 0 && err == nil {
+		foundUser, err = repo.GetUserByEmail(ctx, email)
+		if err == nil && len(foundUser.Id) == 0 {
 			return errors.New(fmt.Sprintf("user with email not found [%s]", email))
 		}
 
@@ -96,6 +221,10 @@ func lookupUserInDynamoDB(email string) (*model.User, error) {
 }
 
 func createCognitoPostSignUpEvent(user model.User, region, userpoolID string) *events.CognitoEventUserPoolsPostConfirmation {
+	return createCognitoPostConfirmationEvent(user, TriggerConfirmSignUp, region, userpoolID)
+}
+
+func createCognitoPostConfirmationEvent(user model.User, triggerSource, region, userpoolID string) *events.CognitoEventUserPoolsPostConfirmation {
 
 	var rawJson bytes.Buffer
 	err := Create("jsonEvent", `{
@@ -103,7 +232,7 @@ func createCognitoPostSignUpEvent(user model.User, region, userpoolID string) *e
         "region": "{{.Region}}",
         "userPoolId": "{{.UserpoolID}}",
         "userName": "{{.Id}}",
-        "triggerSource": "PostConfirmation_ConfirmSignUp",
+        "triggerSource": "{{.TriggerSource}}",
         "request": {
             "userAttributes": {
                 "sub": "{{.Id}}",
@@ -116,11 +245,12 @@ func createCognitoPostSignUpEvent(user model.User, region, userpoolID string) *e
         },
         "response": {}
     }`).Execute(&rawJson, map[string]string{
-		"Region":     region,
-		"UserpoolID": userpoolID,
-		"Id":         user.Id,
-		"Email":      user.Email,
-		"Name":       user.Name,
+		"TriggerSource": triggerSource,
+		"Region":        region,
+		"UserpoolID":    userpoolID,
+		"Id":            user.Id,
+		"Email":         user.Email,
+		"Name":          user.Name,
 	})
 
 	logger := util.NewDevLogger(zerolog.InfoLevel)
@@ -0,0 +1,74 @@
+package get_profile
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// GetProfileEvent is the AppSync direct lambda resolver event for Query.getProfile, which takes no arguments.
+type GetProfileEvent struct {
+	Identity *events.AppSyncCognitoIdentity `json:"identity"`
+}
+
+type GetProfileFn func(ctx context.Context, event GetProfileEvent) (model.MyProfile, error)
+type getProfileHandler struct {
+	clock     util.Clock
+	logger    zerolog.Logger
+	usersRepo ddb.UsersRepo
+}
+
+// Handler returns the profile of the signed in user, whose id is their Cognito sub. A user that has no row, for
+// example because the account was closed while the token was still valid, gets a NotFound GraphQL error.
+func (h *getProfileHandler) Handler(ctx context.Context, event GetProfileEvent) (model.MyProfile, error) {
+
+	logger := h.logger.With().
+		Str("handler", "get-profile").
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	sub, err := appsync.CallerSub(event.Identity)
+	if err != nil {
+		logger.Warn().Msg("getProfile called without a cognito identity")
+		return model.MyProfile{}, appsync.GraphQLError(ctx, "profile", err)
+	}
+
+	user, err := h.usersRepo.GetUserByID(ctx, sub)
+	if err != nil {
+		logger.Err(err).Str("userId", sub).Msg("error reading profile")
+		return model.MyProfile{}, appsync.GraphQLError(ctx, "profile", err)
+	}
+
+	return model.NewMyProfile(user), nil
+}
+
+type GetProfileHandlerOption = func(handler *getProfileHandler) *getProfileHandler
+
+func WithLogger(logger zerolog.Logger) GetProfileHandlerOption {
+	return func(h *getProfileHandler) *getProfileHandler {
+		return &getProfileHandler{
+			clock:     h.clock,
+			logger:    logger,
+			usersRepo: h.usersRepo,
+		}
+	}
+}
+
+func NewGetProfileHandler(clock util.Clock, usersRepo ddb.UsersRepo, options ...GetProfileHandlerOption) GetProfileFn {
+	h := &getProfileHandler{
+		clock:     clock,
+		logger:    zerolog.Nop(),
+		usersRepo: usersRepo,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler
+}
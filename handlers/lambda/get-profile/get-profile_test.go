@@ -0,0 +1,63 @@
+package get_profile
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/testfixtures"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T) (GetProfileFn, *ddb.UsersRepo) {
+	clock := util.NewFixedClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	repo := testfixtures.NewUsersRepo(clock)
+	return NewGetProfileHandler(clock, *repo, WithLogger(testfixtures.NewLogger())), repo
+}
+
+func profileEvent(t *testing.T, sub string) GetProfileEvent {
+	return testfixtures.Event[GetProfileEvent](t, `{"arguments": {}, "identity": {"sub": "`+sub+`", "username": "someone"}}`)
+}
+
+func TestGetProfile(t *testing.T) {
+	ctx := context.TODO()
+	handler, repo := newTestHandler(t)
+
+	user, err := repo.AddUser(ctx, model.User{
+		Id:        gofakeit.UUID(),
+		Email:     gofakeit.Email(),
+		Name:      gofakeit.Username(),
+		CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	profile, err := handler(ctx, profileEvent(t, user.Id))
+	require.NoError(t, err)
+	assert.Equal(t, model.MyProfile{Id: user.Id, Username: user.Name, Email: user.Email, CreatedAt: user.CreatedAt}, profile)
+
+	payload, err := json.Marshal(profile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id": "`+user.Id+`", "username": "`+user.Name+`", "email": "`+user.Email+`", "createdAt": "2024-03-01T12:00:00Z"}`, string(payload))
+}
+
+func TestGetProfile_MissingUser(t *testing.T) {
+	handler, _ := newTestHandler(t)
+
+	_, err := handler(context.TODO(), profileEvent(t, gofakeit.UUID()))
+	require.Error(t, err)
+	assert.Equal(t, appsync.NotFound, appsync.ErrorType(err))
+}
+
+func TestGetProfile_NoIdentity(t *testing.T) {
+	handler, _ := newTestHandler(t)
+
+	_, err := handler(context.TODO(), GetProfileEvent{})
+	assert.Equal(t, appsync.Unauthorized, appsync.ErrorType(err))
+}
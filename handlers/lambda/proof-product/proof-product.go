@@ -0,0 +1,203 @@
+package proof_product
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/projects/cmyk-api/handlers/colour"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/proof"
+	"github.com/projects/cmyk-api/handlers/render"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// ProductProofEvent is the AppSync direct lambda resolver event for Query.productProof.
+type ProductProofEvent struct {
+	Arguments ProductProofArguments          `json:"arguments"`
+	Identity  *events.AppSyncCognitoIdentity `json:"identity"`
+}
+
+type ProductProofArguments struct {
+	ProductID string  `json:"productId"`
+	Size      *string `json:"size"`
+}
+
+// ProductProof matches the ProductProof type in schema.api.graphql. Images are base64 encoded PNGs.
+type ProductProof struct {
+	ProductID  string   `json:"productId"`
+	Rgb        string   `json:"rgb"`
+	Cmyk       Coverage `json:"cmyk"`
+	ProofRgb   string   `json:"proofRgb"`
+	DeltaE     float64  `json:"deltaE"`
+	OutOfGamut bool     `json:"outOfGamut"`
+	Plates     []Plate  `json:"plates"`
+	Preview    string   `json:"preview"`
+	Size       string   `json:"size"`
+}
+
+// Coverage is the ink of each plate as a percentage.
+type Coverage struct {
+	C float64 `json:"c"`
+	M float64 `json:"m"`
+	Y float64 `json:"y"`
+	K float64 `json:"k"`
+}
+
+type Plate struct {
+	Ink      string  `json:"ink"`
+	Coverage float64 `json:"coverage"`
+	Image    string  `json:"image"`
+}
+
+type ProofProductFn func(ctx context.Context, event ProductProofEvent) (ProductProof, error)
+type proofProductHandler struct {
+	clock        util.Clock
+	logger       zerolog.Logger
+	productsRepo ddb.ProductsRepo
+	press        proof.Press
+	template     *render.Template
+}
+
+// Handler separates the product colour into the four process inks and shows what it will look like printed: an
+// image of each plate and the bottle mockup in the printed colour, which is clipped to the press gamut.
+func (h *proofProductHandler) Handler(ctx context.Context, event ProductProofEvent) (ProductProof, error) {
+
+	logger := h.logger.With().
+		Str("handler", "proof-product").
+		Str("productId", event.Arguments.ProductID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	size := render.Card
+	if event.Arguments.Size != nil {
+		var err error
+		if size, err = render.ParseSize(*event.Arguments.Size); err != nil {
+			return ProductProof{}, appsync.GraphQLError(ctx, "product", ddb.NewValidationFailedError(err))
+		}
+	}
+
+	product, err := h.productsRepo.GetProduct(ctx, event.Arguments.ProductID)
+	if err != nil {
+		logger.Err(err).Msg("error reading product")
+		return ProductProof{}, appsync.GraphQLError(ctx, "product", err)
+	}
+	rgb, err := colour.Parse(product.Rgb)
+	if err != nil {
+		logger.Err(err).Str("productRgb", product.Rgb).Msg("product has an invalid colour")
+		return ProductProof{}, appsync.GraphQLError(ctx, "product", fmt.Errorf("product [%s] has an invalid colour: %w", product.Id, err))
+	}
+
+	template := h.template
+	if template == nil {
+		if template, err = render.Bottle(); err != nil {
+			return ProductProof{}, appsync.GraphQLError(ctx, "product", err)
+		}
+	}
+
+	separation := h.press.Separate(rgb)
+	preview, err := encodePNG(template.Render(separation.ProofRGB(), size))
+	if err != nil {
+		return ProductProof{}, appsync.GraphQLError(ctx, "product", err)
+	}
+
+	result := ProductProof{
+		ProductID: product.Id,
+		Rgb:       rgb.Hex(),
+		Cmyk: Coverage{
+			C: percent(separation.CMYK.C),
+			M: percent(separation.CMYK.M),
+			Y: percent(separation.CMYK.Y),
+			K: percent(separation.CMYK.K),
+		},
+		ProofRgb:   separation.ProofRGB().Hex(),
+		DeltaE:     math.Round(separation.DeltaE*100) / 100,
+		OutOfGamut: !separation.InGamut(),
+		Preview:    preview,
+		Size:       size.String(),
+	}
+	for _, ink := range proof.Inks {
+		plate, err := encodePNG(h.press.Plate(separation, ink, int(size)))
+		if err != nil {
+			return ProductProof{}, appsync.GraphQLError(ctx, "product", err)
+		}
+		result.Plates = append(result.Plates, Plate{Ink: ink.String(), Coverage: percent(separation.Coverage(ink)), Image: plate})
+	}
+
+	logger.Info().Str("cmyk", separation.CMYK.String()).Float64("deltaE", separation.DeltaE).Msg("proofed product")
+	return result, nil
+}
+
+func encodePNG(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := render.EncodePNG(&buf, img); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// percent rounds coverage to the tenth of a percent a plate can be set to.
+func percent(coverage float64) float64 {
+	return math.Round(coverage*1000) / 10
+}
+
+type ProofProductHandlerOption = func(handler *proofProductHandler) *proofProductHandler
+
+func WithLogger(logger zerolog.Logger) ProofProductHandlerOption {
+	return func(h *proofProductHandler) *proofProductHandler {
+		return &proofProductHandler{
+			clock:        h.clock,
+			logger:       logger,
+			productsRepo: h.productsRepo,
+			press:        h.press,
+			template:     h.template,
+		}
+	}
+}
+
+// WithPress proofs against another printing condition instead of proof.Coated.
+func WithPress(press proof.Press) ProofProductHandlerOption {
+	return func(h *proofProductHandler) *proofProductHandler {
+		return &proofProductHandler{
+			clock:        h.clock,
+			logger:       h.logger,
+			productsRepo: h.productsRepo,
+			press:        press,
+			template:     h.template,
+		}
+	}
+}
+
+// WithTemplate replaces the bottle with another mockup template for the preview.
+func WithTemplate(template *render.Template) ProofProductHandlerOption {
+	return func(h *proofProductHandler) *proofProductHandler {
+		return &proofProductHandler{
+			clock:        h.clock,
+			logger:       h.logger,
+			productsRepo: h.productsRepo,
+			press:        h.press,
+			template:     template,
+		}
+	}
+}
+
+func NewProofProductHandler(clock util.Clock, productsRepo ddb.ProductsRepo, options ...ProofProductHandlerOption) ProofProductFn {
+	h := &proofProductHandler{
+		clock:        clock,
+		logger:       zerolog.Nop(),
+		productsRepo: productsRepo,
+		press:        proof.Coated,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler
+}
@@ -0,0 +1,70 @@
+package proof_product
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/png"
+	"testing"
+
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/testfixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, rgb string) (ProofProductFn, *model.Product) {
+	clock := testfixtures.NewClock()
+	repo := testfixtures.NewProductsRepo(clock)
+	products := testfixtures.AddProducts(t, repo, rgb)
+
+	return NewProofProductHandler(clock, *repo, WithLogger(testfixtures.NewLogger())), products[0]
+}
+
+func decodePNGWidth(t *testing.T, data string) int {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(raw))
+	require.NoError(t, err)
+	return img.Bounds().Dx()
+}
+
+func TestProofProduct(t *testing.T) {
+	handler, product := newTestHandler(t, "#336699")
+
+	result, err := handler(context.TODO(), testfixtures.Event[ProductProofEvent](t, `{"arguments": {"productId": "`+product.Id+`", "size": "THUMBNAIL"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "#336699", result.Rgb)
+	assert.False(t, result.OutOfGamut)
+	assert.Less(t, result.DeltaE, 2.0)
+	assert.InDelta(t, 40, result.Cmyk.K, 0.1)
+
+	require.Len(t, result.Plates, 4)
+	assert.Equal(t, []string{"CYAN", "MAGENTA", "YELLOW", "BLACK"}, []string{result.Plates[0].Ink, result.Plates[1].Ink, result.Plates[2].Ink, result.Plates[3].Ink})
+	assert.Equal(t, result.Cmyk.C, result.Plates[0].Coverage)
+	for _, plate := range result.Plates {
+		assert.Equal(t, 128, decodePNGWidth(t, plate.Image))
+	}
+	assert.Equal(t, 128, decodePNGWidth(t, result.Preview))
+}
+
+func TestProofProduct_OutOfGamut(t *testing.T) {
+	handler, product := newTestHandler(t, "#00FF00")
+
+	result, err := handler(context.TODO(), testfixtures.Event[ProductProofEvent](t, `{"arguments": {"productId": "`+product.Id+`"}}`))
+	require.NoError(t, err)
+	assert.True(t, result.OutOfGamut)
+	assert.NotEqual(t, result.Rgb, result.ProofRgb, "the preview should show the clipped colour")
+	assert.Equal(t, "CARD", result.Size)
+}
+
+func TestProofProduct_Errors(t *testing.T) {
+	handler, product := newTestHandler(t, "#336699")
+
+	_, err := handler(context.TODO(), testfixtures.Event[ProductProofEvent](t, `{"arguments": {"productId": "missing"}}`))
+	assert.Equal(t, appsync.NotFound, appsync.ErrorType(err))
+
+	_, err = handler(context.TODO(), testfixtures.Event[ProductProofEvent](t, `{"arguments": {"productId": "`+product.Id+`", "size": "POSTER"}}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+}
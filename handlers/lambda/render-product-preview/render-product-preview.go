@@ -0,0 +1,138 @@
+package render_product_preview
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/projects/cmyk-api/handlers/colour"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/render"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// ProductPreviewEvent is the AppSync direct lambda resolver event for Query.productPreview.
+type ProductPreviewEvent struct {
+	Arguments ProductPreviewArguments        `json:"arguments"`
+	Identity  *events.AppSyncCognitoIdentity `json:"identity"`
+}
+
+type ProductPreviewArguments struct {
+	ProductID string  `json:"productId"`
+	Size      *string `json:"size"`
+}
+
+// ProductPreview matches the ProductPreview type in schema.api.graphql. Data is the base64 encoded image.
+type ProductPreview struct {
+	ProductID   string `json:"productId"`
+	Rgb         string `json:"rgb"`
+	Size        string `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"contentType"`
+	Data        string `json:"data"`
+}
+
+type RenderProductPreviewFn func(ctx context.Context, event ProductPreviewEvent) (ProductPreview, error)
+type renderProductPreviewHandler struct {
+	clock        util.Clock
+	logger       zerolog.Logger
+	productsRepo ddb.ProductsRepo
+	template     *render.Template
+}
+
+// Handler renders the bottle mockup of a product in its colour as a PNG. The size defaults to CARD.
+func (h *renderProductPreviewHandler) Handler(ctx context.Context, event ProductPreviewEvent) (ProductPreview, error) {
+
+	logger := h.logger.With().
+		Str("handler", "render-product-preview").
+		Str("productId", event.Arguments.ProductID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	size := render.Card
+	if event.Arguments.Size != nil {
+		var err error
+		if size, err = render.ParseSize(*event.Arguments.Size); err != nil {
+			return ProductPreview{}, appsync.GraphQLError(ctx, "product", ddb.NewValidationFailedError(err))
+		}
+	}
+
+	product, err := h.productsRepo.GetProduct(ctx, event.Arguments.ProductID)
+	if err != nil {
+		logger.Err(err).Msg("error reading product")
+		return ProductPreview{}, appsync.GraphQLError(ctx, "product", err)
+	}
+	rgb, err := colour.Parse(product.Rgb)
+	if err != nil {
+		logger.Err(err).Str("productRgb", product.Rgb).Msg("product has an invalid colour")
+		return ProductPreview{}, appsync.GraphQLError(ctx, "product", fmt.Errorf("product [%s] has an invalid colour: %w", product.Id, err))
+	}
+
+	template := h.template
+	if template == nil {
+		if template, err = render.Bottle(); err != nil {
+			return ProductPreview{}, appsync.GraphQLError(ctx, "product", err)
+		}
+	}
+
+	img := template.Render(rgb, size)
+	var buf bytes.Buffer
+	if err := render.EncodePNG(&buf, img); err != nil {
+		return ProductPreview{}, appsync.GraphQLError(ctx, "product", err)
+	}
+
+	logger.Info().Str("size", size.String()).Int("bytes", buf.Len()).Msg("rendered product preview")
+	return ProductPreview{
+		ProductID:   product.Id,
+		Rgb:         rgb.Hex(),
+		Size:        size.String(),
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		ContentType: "image/png",
+		Data:        base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+type RenderProductPreviewHandlerOption = func(handler *renderProductPreviewHandler) *renderProductPreviewHandler
+
+func WithLogger(logger zerolog.Logger) RenderProductPreviewHandlerOption {
+	return func(h *renderProductPreviewHandler) *renderProductPreviewHandler {
+		return &renderProductPreviewHandler{
+			clock:        h.clock,
+			logger:       logger,
+			productsRepo: h.productsRepo,
+			template:     h.template,
+		}
+	}
+}
+
+// WithTemplate replaces the bottle with another mockup template.
+func WithTemplate(template *render.Template) RenderProductPreviewHandlerOption {
+	return func(h *renderProductPreviewHandler) *renderProductPreviewHandler {
+		return &renderProductPreviewHandler{
+			clock:        h.clock,
+			logger:       h.logger,
+			productsRepo: h.productsRepo,
+			template:     template,
+		}
+	}
+}
+
+func NewRenderProductPreviewHandler(clock util.Clock, productsRepo ddb.ProductsRepo, options ...RenderProductPreviewHandlerOption) RenderProductPreviewFn {
+	h := &renderProductPreviewHandler{
+		clock:        clock,
+		logger:       zerolog.Nop(),
+		productsRepo: productsRepo,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler
+}
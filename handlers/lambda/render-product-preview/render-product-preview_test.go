@@ -0,0 +1,54 @@
+package render_product_preview
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/png"
+	"testing"
+
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/testfixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T) (RenderProductPreviewFn, *model.Product) {
+	clock := testfixtures.NewClock()
+	repo := testfixtures.NewProductsRepo(clock)
+	products := testfixtures.AddProducts(t, repo, "#C81428")
+
+	return NewRenderProductPreviewHandler(clock, *repo, WithLogger(testfixtures.NewLogger())), products[0]
+}
+
+func TestRenderProductPreview(t *testing.T) {
+	handler, product := newTestHandler(t)
+
+	preview, err := handler(context.TODO(), testfixtures.Event[ProductPreviewEvent](t, `{"arguments": {"productId": "`+product.Id+`", "size": "THUMBNAIL"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "#C81428", preview.Rgb)
+	assert.Equal(t, "THUMBNAIL", preview.Size)
+	assert.Equal(t, "image/png", preview.ContentType)
+
+	data, err := base64.StdEncoding.DecodeString(preview.Data)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+	assert.Equal(t, preview.Width, img.Bounds().Dx())
+
+	preview, err = handler(context.TODO(), testfixtures.Event[ProductPreviewEvent](t, `{"arguments": {"productId": "`+product.Id+`"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "CARD", preview.Size)
+}
+
+func TestRenderProductPreview_Errors(t *testing.T) {
+	handler, product := newTestHandler(t)
+
+	_, err := handler(context.TODO(), testfixtures.Event[ProductPreviewEvent](t, `{"arguments": {"productId": "missing"}}`))
+	assert.Equal(t, appsync.NotFound, appsync.ErrorType(err))
+
+	_, err = handler(context.TODO(), testfixtures.Event[ProductPreviewEvent](t, `{"arguments": {"productId": "`+product.Id+`", "size": "HUGE"}}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+}
@@ -0,0 +1,209 @@
+package search_products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/projects/cmyk-api/handlers/colour"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/proof"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// SearchProductsEvent is the AppSync direct lambda resolver event for Query.searchProducts.
+type SearchProductsEvent struct {
+	Arguments SearchProductsArguments        `json:"arguments"`
+	Identity  *events.AppSyncCognitoIdentity `json:"identity"`
+}
+
+type SearchProductsArguments struct {
+	ProductSearchInput ProductSearchInput `json:"productSearchInput"`
+	Limit              int32              `json:"limit"`
+	NextToken          *string            `json:"nextToken"`
+}
+
+type ProductSearchInput struct {
+	Rgb string `json:"rgb"`
+}
+
+// ProductSearchResults matches the ProductSearchResults type in schema.api.graphql.
+type ProductSearchResults struct {
+	Products  []model.Product `json:"products"`
+	NextToken *string         `json:"nextToken"`
+}
+
+type SearchProductsFn func(ctx context.Context, event SearchProductsEvent) (ProductSearchResults, error)
+type searchProductsHandler struct {
+	clock        util.Clock
+	logger       zerolog.Logger
+	productsRepo ddb.ProductsRepo
+	pageTokens   ddb.PageTokenCodec
+	press        proof.Press
+}
+
+type rankedProduct struct {
+	product  *model.Product
+	rgb      colour.RGB
+	distance float64
+}
+
+// Handler ranks the products near the requested colour by CIEDE2000 distance, closest first, and returns the page
+// of results the nextToken points at. The token is bound to the searched colour so it cannot be replayed against
+// a different search.
+func (h *searchProductsHandler) Handler(ctx context.Context, event SearchProductsEvent) (ProductSearchResults, error) {
+
+	logger := h.logger.With().
+		Str("handler", "search-products").
+		Str("rgb", event.Arguments.ProductSearchInput.Rgb).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	target, err := colour.Parse(event.Arguments.ProductSearchInput.Rgb)
+	if err != nil {
+		return ProductSearchResults{}, appsync.GraphQLError(ctx, "product", ddb.NewValidationFailedError(err))
+	}
+	limit := event.Arguments.Limit
+	if limit < 1 || limit > ddb.MaxPageLimit {
+		return ProductSearchResults{}, appsync.GraphQLError(ctx, "product", ddb.NewValidationFailedError(fmt.Errorf("limit must be between 1 and %d but was %d", ddb.MaxPageLimit, limit)))
+	}
+
+	scope := "searchProducts/" + target.Hex()
+	offset, err := h.decodeOffset(scope, event.Arguments.NextToken)
+	if err != nil {
+		return ProductSearchResults{}, appsync.GraphQLError(ctx, "product", err)
+	}
+
+	ranked, err := h.rankNearby(ctx, target.Lab(), offset+int(limit)+1)
+	if err != nil {
+		logger.Err(err).Msg("error reading products")
+		return ProductSearchResults{}, appsync.GraphQLError(ctx, "product", err)
+	}
+
+	results := ProductSearchResults{Products: []model.Product{}}
+	end := offset + int(limit)
+	for i := offset; i < end && i < len(ranked); i++ {
+		// the gamut check is only worth its cost for the products actually returned
+		product := *ranked[i].product
+		product.OutOfGamut = !h.press.InGamut(ranked[i].rgb)
+		results.Products = append(results.Products, product)
+	}
+	if end < len(ranked) {
+		token, err := h.pageTokens.Encode(scope, map[string]types.AttributeValue{
+			"offset": &types.AttributeValueMemberN{Value: strconv.Itoa(end)},
+		})
+		if err != nil {
+			return ProductSearchResults{}, appsync.GraphQLError(ctx, "product", err)
+		}
+		results.NextToken = &token
+	}
+
+	logger.Info().Int("matches", len(ranked)).Int("offset", offset).Msg("searched products")
+	return results, nil
+}
+
+// rankNearby reads rings of colour buckets outwards from the target, ranking the products found by their CIEDE2000
+// distance from it, closest first. A product in ring r+1 is at least r*BucketSize Lab units from the target, so
+// the search stops once it holds wanted products closer than that, or when no further bucket can hold an sRGB
+// colour. The rings are laid out in Lab, so the stopping bound is checked against the Lab (ΔE76) distances; a
+// CIEDE2000 distance can be much smaller than the Lab distance and would stop the search too early. A sparse
+// catalogue is searched to the edge of the colour space rather than coming back empty.
+func (h *searchProductsHandler) rankNearby(ctx context.Context, target colour.Lab, wanted int) ([]rankedProduct, error) {
+	logger := zerolog.Ctx(ctx)
+	bucket := colour.BucketOf(target)
+
+	var ranked []rankedProduct
+	var labDistances []float64
+	for ring := 0; ring <= bucket.MaxRing(); ring++ {
+		found, err := h.productsRepo.QueryColourBuckets(ctx, bucket.Ring(ring))
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range found {
+			rgb, err := colour.ParseHex(product.Rgb)
+			if err != nil {
+				logger.Warn().Str("product", product.Id).Str("productRgb", product.Rgb).Msg("skipping product with an invalid colour")
+				continue
+			}
+			lab := rgb.Lab()
+			ranked = append(ranked, rankedProduct{product: product, rgb: rgb, distance: colour.DeltaE2000(target, lab)})
+			labDistances = append(labDistances, colour.DeltaE76(target, lab))
+		}
+
+		sort.Float64s(labDistances)
+		if len(labDistances) >= wanted && labDistances[wanted-1] < float64(ring)*colour.BucketSize {
+			break
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].distance != ranked[j].distance {
+			return ranked[i].distance < ranked[j].distance
+		}
+		return ranked[i].product.Id < ranked[j].product.Id
+	})
+	return ranked, nil
+}
+
+func (h *searchProductsHandler) decodeOffset(scope string, nextToken *string) (int, error) {
+	if nextToken == nil || len(*nextToken) == 0 {
+		return 0, nil
+	}
+
+	key, err := h.pageTokens.Decode(scope, *nextToken)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := key["offset"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, ddb.NewValidationFailedError(fmt.Errorf("invalid nextToken"))
+	}
+	offset, err := strconv.Atoi(n.Value)
+	if err != nil || offset < 0 {
+		return 0, ddb.NewValidationFailedError(fmt.Errorf("invalid nextToken"))
+	}
+	return offset, nil
+}
+
+type SearchProductsHandlerOption = func(handler *searchProductsHandler) *searchProductsHandler
+
+func WithLogger(logger zerolog.Logger) SearchProductsHandlerOption {
+	return func(h *searchProductsHandler) *searchProductsHandler {
+		return &searchProductsHandler{
+			clock:        h.clock,
+			logger:       logger,
+			productsRepo: h.productsRepo,
+			pageTokens:   h.pageTokens,
+			press:        h.press,
+		}
+	}
+}
+
+// NewSearchProductsHandler fails when pageTokens was not created by ddb.NewPageTokenCodec, as the handler could
+// not sign its nextTokens.
+func NewSearchProductsHandler(clock util.Clock, productsRepo ddb.ProductsRepo, pageTokens ddb.PageTokenCodec, options ...SearchProductsHandlerOption) (SearchProductsFn, error) {
+	if pageTokens.IsZero() {
+		return nil, errors.New("search-products needs a page token codec with a secret")
+	}
+
+	h := &searchProductsHandler{
+		clock:        clock,
+		logger:       zerolog.Nop(),
+		productsRepo: productsRepo,
+		pageTokens:   pageTokens,
+		press:        proof.Coated,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler, nil
+}
@@ -0,0 +1,112 @@
+package search_products
+
+import (
+	"context"
+	"testing"
+
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/testfixtures"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, rgbs ...string) SearchProductsFn {
+	clock := testfixtures.NewClock()
+	repo := testfixtures.NewProductsRepo(clock)
+	testfixtures.AddProducts(t, repo, rgbs...)
+
+	pageTokens, err := ddb.NewPageTokenCodec([]byte("secret"))
+	require.NoError(t, err)
+	handler, err := NewSearchProductsHandler(clock, *repo, pageTokens, WithLogger(testfixtures.NewLogger()))
+	require.NoError(t, err)
+	return handler
+}
+
+func ids(results ProductSearchResults) []string {
+	var out []string
+	for _, p := range results.Products {
+		out = append(out, p.Id)
+	}
+	return out
+}
+
+func TestSearchProducts_RanksByPerceivedDistance(t *testing.T) {
+	ctx := context.TODO()
+	handler := newTestHandler(t, "#0000FF", "#FF0000", "#F01010", "#E02020", "#C83232", "#00FF00", "#FFFFFF")
+
+	event := testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#FF0000"}, "limit": 2}, "identity": {"sub": "abc"}}`)
+	first, err := handler(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"#FF0000", "#F01010"}, ids(first))
+	require.NotNil(t, first.NextToken)
+
+	event.Arguments.NextToken = first.NextToken
+	second, err := handler(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"#E02020", "#C83232"}, ids(second))
+	require.NotNil(t, second.NextToken, "the blue, green and white products are far away but still further matches")
+
+	event.Arguments.NextToken = second.NextToken
+	event.Arguments.Limit = 10
+	rest, err := handler(ctx, event)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"#0000FF", "#00FF00", "#FFFFFF"}, ids(rest))
+	assert.Nil(t, rest.NextToken)
+}
+
+func TestSearchProducts_FindsCloserProductsInFurtherRings(t *testing.T) {
+	ctx := context.TODO()
+	// #5480B0 is two buckets away from grey but closer to it than #90B0B4, which is in the next bucket
+	handler := newTestHandler(t, "#90B0BC", "#90B0B4", "#5480B0")
+
+	results, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#808080"}, "limit": 1}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"#5480B0"}, ids(results))
+}
+
+func TestSearchProducts_SparseCatalogue(t *testing.T) {
+	ctx := context.TODO()
+	handler := newTestHandler(t, "#000000", "#FFFFFF")
+
+	results, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#FF0000"}, "limit": 10}}`))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"#000000", "#FFFFFF"}, ids(results), "the nearest products are returned however far away they are")
+	assert.Nil(t, results.NextToken)
+}
+
+func TestSearchProducts_FlagsOutOfGamutColours(t *testing.T) {
+	ctx := context.TODO()
+	handler := newTestHandler(t, "#0000FF", "#336699")
+
+	blue, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#0000FF"}, "limit": 1}}`))
+	require.NoError(t, err)
+	require.Len(t, blue.Products, 1)
+	assert.True(t, blue.Products[0].OutOfGamut, "screen blue cannot be printed")
+
+	slate, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#336699"}, "limit": 1}}`))
+	require.NoError(t, err)
+	require.Len(t, slate.Products, 1)
+	assert.False(t, slate.Products[0].OutOfGamut)
+}
+
+func TestSearchProducts_RejectsBadInput(t *testing.T) {
+	ctx := context.TODO()
+	handler := newTestHandler(t, "#0000FF", "#FF0000", "#F01010", "#00FF00")
+
+	_, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "red"}, "limit": 2}}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+
+	_, err = handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#FF0000"}, "limit": 0}}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+
+	first, err := handler(ctx, testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#FF0000"}, "limit": 1}}`))
+	require.NoError(t, err)
+	require.NotNil(t, first.NextToken)
+
+	// a token issued for one colour cannot be used to page another search
+	other := testfixtures.Event[SearchProductsEvent](t, `{"arguments": {"productSearchInput": {"rgb": "#00FF00"}, "limit": 1}}`)
+	other.Arguments.NextToken = first.NextToken
+	_, err = handler(ctx, other)
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+}
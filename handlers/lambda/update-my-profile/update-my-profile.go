@@ -0,0 +1,85 @@
+package update_my_profile
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+)
+
+// UpdateMyProfileEvent is the AppSync direct lambda resolver event for Mutation.updateMyProfile.
+type UpdateMyProfileEvent struct {
+	Arguments UpdateMyProfileArguments       `json:"arguments"`
+	Identity  *events.AppSyncCognitoIdentity `json:"identity"`
+}
+
+type UpdateMyProfileArguments struct {
+	Input UpdateMyProfileInput `json:"input"`
+}
+
+// UpdateMyProfileInput matches the UpdateMyProfileInput input in schema.api.graphql. Omitted fields are unchanged.
+type UpdateMyProfileInput struct {
+	Username *string `json:"username"`
+}
+
+type UpdateMyProfileFn func(ctx context.Context, event UpdateMyProfileEvent) (model.MyProfile, error)
+type updateMyProfileHandler struct {
+	clock     util.Clock
+	logger    zerolog.Logger
+	usersRepo ddb.UsersRepo
+}
+
+// Handler changes the profile of the signed in user and returns the updated profile. Invalid input is reported as
+// a ValidationFailed GraphQL error and a profile changed by another request at the same time as ConditionFailed,
+// which the client can retry.
+func (h *updateMyProfileHandler) Handler(ctx context.Context, event UpdateMyProfileEvent) (model.MyProfile, error) {
+
+	logger := h.logger.With().
+		Str("handler", "update-my-profile").
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	sub, err := appsync.CallerSub(event.Identity)
+	if err != nil {
+		logger.Warn().Msg("updateMyProfile called without a cognito identity")
+		return model.MyProfile{}, appsync.GraphQLError(ctx, "profile", err)
+	}
+
+	user, err := h.usersRepo.UpdateProfile(ctx, sub, model.ProfileUpdate{Name: event.Arguments.Input.Username})
+	if err != nil {
+		logger.Err(err).Str("userId", sub).Msg("error updating profile")
+		return model.MyProfile{}, appsync.GraphQLError(ctx, "profile", err)
+	}
+
+	return model.NewMyProfile(user), nil
+}
+
+type UpdateMyProfileHandlerOption = func(handler *updateMyProfileHandler) *updateMyProfileHandler
+
+func WithLogger(logger zerolog.Logger) UpdateMyProfileHandlerOption {
+	return func(h *updateMyProfileHandler) *updateMyProfileHandler {
+		return &updateMyProfileHandler{
+			clock:     h.clock,
+			logger:    logger,
+			usersRepo: h.usersRepo,
+		}
+	}
+}
+
+func NewUpdateMyProfileHandler(clock util.Clock, usersRepo ddb.UsersRepo, options ...UpdateMyProfileHandlerOption) UpdateMyProfileFn {
+	h := &updateMyProfileHandler{
+		clock:     clock,
+		logger:    zerolog.Nop(),
+		usersRepo: usersRepo,
+	}
+
+	for _, option := range options {
+		h = option(h)
+	}
+
+	return h.Handler
+}
@@ -0,0 +1,60 @@
+package update_my_profile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/lambda/appsync"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/testfixtures"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T) (UpdateMyProfileFn, *ddb.UsersRepo, *model.User) {
+	clock := testfixtures.NewClock()
+	repo := testfixtures.NewUsersRepo(clock)
+
+	user, err := repo.AddUser(context.TODO(), util.RandomTestUser(util.WithCreatedAt(clock.Now())))
+	require.NoError(t, err)
+
+	return NewUpdateMyProfileHandler(clock, *repo, WithLogger(testfixtures.NewLogger())), repo, user
+}
+
+func updateEvent(t *testing.T, sub string, input string) UpdateMyProfileEvent {
+	return testfixtures.Event[UpdateMyProfileEvent](t, `{"arguments": {"input": `+input+`}, "identity": {"sub": "`+sub+`"}}`)
+}
+
+func TestUpdateMyProfile(t *testing.T) {
+	ctx := context.TODO()
+	handler, repo, user := newTestHandler(t)
+
+	profile, err := handler(ctx, updateEvent(t, user.Id, `{"username": "Teal Collector"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Teal Collector", profile.Username)
+	assert.Equal(t, user.Email, profile.Email)
+
+	got, err := repo.GetUserByID(ctx, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "Teal Collector", got.Name)
+}
+
+func TestUpdateMyProfile_Errors(t *testing.T) {
+	ctx := context.TODO()
+	handler, _, user := newTestHandler(t)
+
+	_, err := handler(ctx, updateEvent(t, user.Id, `{"username": ""}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+
+	_, err = handler(ctx, updateEvent(t, user.Id, `{}`))
+	assert.Equal(t, appsync.ValidationFailed, appsync.ErrorType(err))
+
+	_, err = handler(ctx, updateEvent(t, gofakeit.UUID(), `{"username": "nobody"}`))
+	assert.Equal(t, appsync.NotFound, appsync.ErrorType(err))
+
+	_, err = handler(ctx, UpdateMyProfileEvent{})
+	assert.Equal(t, appsync.Unauthorized, appsync.ErrorType(err))
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// LifespanEnvKey configures how long test data lives in an environment, e.g. "long" in staging.
+const LifespanEnvKey = "TEST_DATA_LIFESPAN"
+
+// Lifespan is how long test data is kept before DynamoDB expires it. The named lifespans cover most fixtures and
+// Custom any other duration. None keeps the data with no TTL.
+type Lifespan time.Duration
+
+const (
+	None      Lifespan = 0
+	Ephemeral          = Lifespan(time.Hour)
+	Short              = Lifespan(24 * time.Hour)
+	Medium             = Lifespan(7 * 24 * time.Hour)
+	Long               = Lifespan(30 * 24 * time.Hour)
+)
+
+var lifespanNames = []struct {
+	name     string
+	lifespan Lifespan
+}{
+	{"none", None},
+	{"ephemeral", Ephemeral},
+	{"short", Short},
+	{"medium", Medium},
+	{"long", Long},
+}
+
+func Custom(d time.Duration) Lifespan {
+	return Lifespan(d)
+}
+
+func (l Lifespan) Duration() time.Duration {
+	return time.Duration(l)
+}
+
+// ExpiresAt is the TTL, in Unix seconds, of data created at now. It is false for None.
+func (l Lifespan) ExpiresAt(now time.Time) (int64, bool) {
+	if l == None {
+		return 0, false
+	}
+	return now.Add(l.Duration()).Unix(), true
+}
+
+// ParseLifespan reads a lifespan name, such as "short", or a duration, such as "36h" or "3d".
+func ParseLifespan(s string) (Lifespan, error) {
+	s = strings.TrimSpace(s)
+	for _, named := range lifespanNames {
+		if strings.EqualFold(s, named.name) {
+			return named.lifespan, nil
+		}
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return None, fmt.Errorf("invalid lifespan [%s]", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return None, fmt.Errorf("invalid lifespan [%s]", s)
+		}
+		d = parsed
+	}
+	if d < 0 {
+		return None, fmt.Errorf("lifespan must not be negative [%s]", s)
+	}
+	return Custom(d), nil
+}
+
+// LifespanFromEnv reads the lifespan from the environment variable key, returning fallback when it is not set.
+func LifespanFromEnv(key string, fallback Lifespan) (Lifespan, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(strings.TrimSpace(value)) == 0 {
+		return fallback, nil
+	}
+	lifespan, err := ParseLifespan(value)
+	if err != nil {
+		return None, fmt.Errorf("%s: %w", key, err)
+	}
+	return lifespan, nil
+}
+
+// String is the lifespan's name, or its duration in whole days or as a time.Duration when it is custom. It is
+// read back by ParseLifespan.
+func (l Lifespan) String() string {
+	for _, named := range lifespanNames {
+		if named.lifespan == l {
+			return named.name
+		}
+	}
+	day := Lifespan(24 * time.Hour)
+	if l > 0 && l%day == 0 {
+		return fmt.Sprintf("%dd", l/day)
+	}
+	return l.Duration().String()
+}
+
+func (l Lifespan) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Lifespan) UnmarshalText(text []byte) error {
+	parsed, err := ParseLifespan(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// UnmarshalJSON also accepts the numbers Lifespan was written as before it had names, 0 for None and 1 for Short.
+func (l *Lifespan) UnmarshalJSON(data []byte) error {
+	var legacy int
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		switch legacy {
+		case 0:
+			*l = None
+		case 1:
+			*l = Short
+		default:
+			return fmt.Errorf("invalid lifespan [%d]", legacy)
+		}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("lifespan must be a string: %w", err)
+	}
+	return l.UnmarshalText([]byte(s))
+}
+
+// MarshalDynamoDBAttributeValue stores the lifespan as its String, so items are readable in the console.
+func (l Lifespan) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberS{Value: l.String()}, nil
+}
+
+func (l *Lifespan) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	s, ok := av.(*types.AttributeValueMemberS)
+	if !ok {
+		return fmt.Errorf("lifespan must be a string attribute, got %T", av)
+	}
+	return l.UnmarshalText([]byte(s.Value))
+}
+
+// TestLifespan is the TTL of test data created at now. None has no TTL and returns 0. A negative lifespan, which
+// cannot be parsed but can be converted to, is treated as Short so test data is never kept by mistake.
+func TestLifespan(l Lifespan, now time.Time) int64 {
+	if l < 0 {
+		l = Short
+	}
+	expiresAt, _ := l.ExpiresAt(now)
+	return expiresAt
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLifespan(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Lifespan
+	}{
+		{"none", None},
+		{"Ephemeral", Ephemeral},
+		{" short ", Short},
+		{"MEDIUM", Medium},
+		{"long", Long},
+		{"90m", Custom(90 * time.Minute)},
+		{"3d", Custom(3 * 24 * time.Hour)},
+		{"0s", None},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLifespan(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := ParseLifespan(got.String())
+			require.NoError(t, err)
+			assert.Equal(t, got, again, "String should parse back to the same lifespan")
+		})
+	}
+
+	for _, bad := range []string{"", "forever", "-1h", "-2d", "1.5d", "d"} {
+		_, err := ParseLifespan(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLifespanString(t *testing.T) {
+	assert.Equal(t, "medium", Medium.String())
+	assert.Equal(t, "2d", Custom(48*time.Hour).String())
+	assert.Equal(t, "1h30m0s", Custom(90*time.Minute).String())
+}
+
+func TestLifespanFromEnv(t *testing.T) {
+	t.Setenv(LifespanEnvKey, "")
+	lifespan, err := LifespanFromEnv(LifespanEnvKey, Short)
+	require.NoError(t, err)
+	assert.Equal(t, Short, lifespan, "an unset lifespan falls back")
+
+	t.Setenv(LifespanEnvKey, "long")
+	lifespan, err = LifespanFromEnv(LifespanEnvKey, Short)
+	require.NoError(t, err)
+	assert.Equal(t, Long, lifespan)
+
+	t.Setenv(LifespanEnvKey, "soon")
+	_, err = LifespanFromEnv(LifespanEnvKey, Short)
+	assert.ErrorContains(t, err, LifespanEnvKey)
+}
+
+func TestLifespanJSON(t *testing.T) {
+	data, err := json.Marshal(MetaData{IsTest: true, Lifespan: Custom(36 * time.Hour)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"isTest": true, "lifespan": "36h0m0s", "expiresAt": null}`, string(data))
+
+	var metadata MetaData
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	assert.Equal(t, Custom(36*time.Hour), metadata.Lifespan)
+
+	// lifespans were written as numbers before they had names
+	require.NoError(t, json.Unmarshal([]byte(`{"lifespan": 1}`), &metadata))
+	assert.Equal(t, Short, metadata.Lifespan)
+	require.NoError(t, json.Unmarshal([]byte(`{"lifespan": 0}`), &metadata))
+	assert.Equal(t, None, metadata.Lifespan)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"lifespan": 7}`), &metadata))
+	assert.Error(t, json.Unmarshal([]byte(`{"lifespan": "forever"}`), &metadata))
+}
+
+func TestLifespanDynamoDB(t *testing.T) {
+	type item struct {
+		Lifespan Lifespan `dynamodbav:"lifespan"`
+	}
+
+	av, err := attributevalue.MarshalMap(item{Lifespan: Medium})
+	require.NoError(t, err)
+
+	var got item
+	require.NoError(t, attributevalue.UnmarshalMap(av, &got))
+	assert.Equal(t, Medium, got.Lifespan)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "medium"}, av["lifespan"])
+}
+
+func TestLifespanExpiresAt(t *testing.T) {
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	expiresAt, ok := Ephemeral.ExpiresAt(now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour).Unix(), expiresAt)
+
+	_, ok = None.ExpiresAt(now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact base 10 number such as 12.99. It is held as an unscaled integer and a scale, so prices are
+// never rounded through a float, and it keeps the scale it was written with: "12.90" stays "12.90".
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal reads a plain decimal string such as "12.99", "-0.5" or "100". Exponents are not accepted.
+func ParseDecimal(s string) (Decimal, error) {
+	value := strings.TrimSpace(s)
+	digits := value
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		digits = value[1:]
+	}
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if len(whole) == 0 && len(fraction) == 0 {
+		return Decimal{}, fmt.Errorf("invalid decimal [%s]", s)
+	}
+	for _, c := range whole + fraction {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal [%s]", s)
+		}
+	}
+
+	unscaled, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal [%s]", s)
+	}
+	if strings.HasPrefix(value, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{unscaled: unscaled, scale: int32(len(fraction))}, nil
+}
+
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) bigInt() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+func (d Decimal) Sign() int {
+	return d.bigInt().Sign()
+}
+
+// rescale returns the unscaled value of d at a larger scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.scale)), nil)
+	return factor.Mul(factor, d.bigInt())
+}
+
+func align(a, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{unscaled: a.Add(a, b), scale: scale}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{unscaled: a.Sub(a, b), scale: scale}
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.bigInt(), other.bigInt()), scale: d.scale + other.scale}
+}
+
+// Cmp compares numerically, so 12.9 and 12.90 are equal.
+func (d Decimal) Cmp(other Decimal) int {
+	a, b, _ := align(d, other)
+	return a.Cmp(b)
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.bigInt()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-d.scale))
+	}
+	if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := ParseDecimal(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+type CurrencyCode string
+
+const (
+	GBP CurrencyCode = "GBP"
+	USD CurrencyCode = "USD"
+)
+
+func ParseCurrencyCode(s string) (CurrencyCode, error) {
+	code := CurrencyCode(strings.ToUpper(strings.TrimSpace(s)))
+	if code != GBP && code != USD {
+		return "", fmt.Errorf("unsupported currency code [%s]", s)
+	}
+	return code, nil
+}
+
+// MinorUnits is the number of decimal places the currency is priced in, e.g. 2 for pence.
+func (c CurrencyCode) MinorUnits() int32 {
+	return 2
+}
+
+// Money matches the Money type in schema.api.graphql, where the amount is a Decimal object named price.
+type Money struct {
+	Price        Decimal      `json:"price"`
+	CurrencyCode CurrencyCode `json:"currencyCode"`
+}
+
+// NewMoney parses an amount in the given currency, rejecting negative amounts and more decimal places than the
+// currency has minor units.
+func NewMoney(amount string, currencyCode CurrencyCode) (Money, error) {
+	code, err := ParseCurrencyCode(string(currencyCode))
+	if err != nil {
+		return Money{}, err
+	}
+	price, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	if price.Sign() < 0 {
+		return Money{}, fmt.Errorf("amount must not be negative [%s]", amount)
+	}
+	if price.Scale() > code.MinorUnits() {
+		return Money{}, fmt.Errorf("amount [%s] has more than %d decimal places for %s", amount, code.MinorUnits(), code)
+	}
+	return Money{Price: price, CurrencyCode: code}, nil
+}
+
+func (m Money) String() string {
+	return m.Price.String() + " " + string(m.CurrencyCode)
+}
+
+type decimalJSON struct {
+	Value string `json:"value"`
+}
+
+// MarshalJSON writes the Decimal object of the GraphQL schema, {"value": "12.99"}.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(decimalJSON{Value: d.String()})
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	var value decimalJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(value.Value))
+}
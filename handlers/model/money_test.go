@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"12.99", "12.99"},
+		{"12.90", "12.90"},
+		{"-0.5", "-0.5"},
+		{".5", "0.5"},
+		{"100", "100"},
+		{"0.001", "0.001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDecimal(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d.String())
+		})
+	}
+
+	for _, bad := range []string{"", ".", "1e3", "12.9.9", "NaN", "£1", "+-5"} {
+		_, err := ParseDecimal(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestDecimalArithmeticIsExact(t *testing.T) {
+	// 0.1 + 0.2 is the classic float rounding failure
+	sum := MustParseDecimal("0.1").Add(MustParseDecimal("0.2"))
+	assert.Equal(t, "0.3", sum.String())
+
+	assert.Equal(t, "9.01", MustParseDecimal("10").Sub(MustParseDecimal("0.99")).String())
+	assert.Equal(t, "38.97", MustParseDecimal("12.99").Mul(NewDecimal(3, 0)).String())
+	assert.True(t, MustParseDecimal("12.9").Equal(MustParseDecimal("12.90")))
+	assert.Equal(t, -1, MustParseDecimal("2").Cmp(MustParseDecimal("10")))
+}
+
+func TestNewMoney(t *testing.T) {
+	m, err := NewMoney("12.99", "gbp")
+	require.NoError(t, err)
+	assert.Equal(t, "12.99 GBP", m.String())
+
+	_, err = NewMoney("1.999", GBP)
+	assert.Error(t, err)
+	_, err = NewMoney("-1", GBP)
+	assert.Error(t, err)
+	_, err = NewMoney("1", "EUR")
+	assert.Error(t, err)
+}
+
+func TestMoneyJSONMatchesSchema(t *testing.T) {
+	m, err := NewMoney("12.90", USD)
+	require.NoError(t, err)
+
+	out, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price":{"value":"12.90"},"currencyCode":"USD"}`, string(out))
+
+	var back Money
+	require.NoError(t, json.Unmarshal(out, &back))
+	assert.Equal(t, m, back)
+}
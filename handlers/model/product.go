@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+type Product struct {
+	Id          string `json:"id"`
+	Rgb         string `json:"rgb" validate:"required"`
+	Description string `json:"description" validate:"required,max=1024"`
+	Price       Money  `json:"price"`
+	// OutOfGamut warns that the colour cannot be printed faithfully in CMYK, see proof.Coated. It is not stored,
+	// the resolvers that return it work it out for the products they return.
+	OutOfGamut bool      `json:"outOfGamut"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	// Version counts the writes to the product, starting at 1. UpdateProduct only applies a change made to the
+	// version it was read at, unless it is 0.
+	Version int64 `json:"version"`
+}
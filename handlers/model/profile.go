@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// MyProfile is the view of a user its owner sees, matching the MyProfile type in schema.api.graphql.
+type MyProfile struct {
+	Id        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NewMyProfile maps a user to their profile. The username is the display name the user signed up with.
+func NewMyProfile(user *User) MyProfile {
+	return MyProfile{
+		Id:        user.Id,
+		Username:  user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt.UTC(),
+	}
+}
+
+// ProfileUpdate holds the profile fields a user can change. Nil fields are left as they are.
+type ProfileUpdate struct {
+	Name *string `json:"name" validate:"omitempty,min=1,displayname"`
+}
+
+func (u ProfileUpdate) IsEmpty() bool {
+	return u.Name == nil
+}
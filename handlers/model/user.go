@@ -4,12 +4,20 @@ import (
 	"time"
 )
 
+// MaxNameLength bounds the display name of a user. The displayname validate tag applies it wherever a name is
+// written, so a name accepted in one place is not rejected in another.
+const MaxNameLength = 128
+
 type User struct {
-	Id        string    `json:"username" validate:"required"`
-	Email     string    `json:"email" validate:"required"`
+	Id        string    `json:"username" validate:"required,max=128"`
+	Email     string    `json:"email" validate:"required,email,max=254"`
 	CreatedAt time.Time `json:"createdAt" validate:"required"`
-	Name      string    `json:"name"`
-	MetaData  MetaData  `json:"metadata"`
+	Name      string    `json:"name" validate:"displayname"`
+	// LastPasswordResetAt is nil until the user confirms a forgotten password.
+	LastPasswordResetAt *time.Time `json:"lastPasswordResetAt,omitempty"`
+	// Version counts the writes to the user, starting at 1. It is 0 for users written before it was recorded.
+	Version  int64    `json:"version"`
+	MetaData MetaData `json:"metadata"`
 }
 
 type MetaData struct {
@@ -17,19 +25,3 @@ type MetaData struct {
 	Lifespan  Lifespan `json:"lifespan"`
 	ExpiresAt *int64   `json:"expiresAt"`
 }
-
-type Lifespan int64
-
-const (
-	None Lifespan = iota
-	Short
-)
-
-func TestLifespan(l Lifespan, now time.Time) int64 {
-	switch l {
-	case Short:
-		return now.Add(1 * (24 * time.Hour)).Unix()
-	default:
-		return TestLifespan(Short, now)
-	}
-}
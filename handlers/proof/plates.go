@@ -0,0 +1,80 @@
+package proof
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/projects/cmyk-api/handlers/colour"
+)
+
+// Ink is one of the four process inks, each printed from its own plate.
+type Ink int
+
+const (
+	Cyan Ink = iota
+	Magenta
+	Yellow
+	Black
+)
+
+// Inks are the process inks in the order they are printed.
+var Inks = []Ink{Cyan, Magenta, Yellow, Black}
+
+// String returns the Ink names used in schema.api.graphql.
+func (i Ink) String() string {
+	switch i {
+	case Cyan:
+		return "CYAN"
+	case Magenta:
+		return "MAGENTA"
+	case Yellow:
+		return "YELLOW"
+	case Black:
+		return "BLACK"
+	}
+	return fmt.Sprintf("Ink(%d)", int(i))
+}
+
+func ParseInk(s string) (Ink, error) {
+	for _, ink := range Inks {
+		if strings.EqualFold(ink.String(), s) {
+			return ink, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ink [%s]", s)
+}
+
+// Coverage is the amount of ink between 0 and 1 the separation prints.
+func (s Separation) Coverage(ink Ink) float64 {
+	switch ink {
+	case Cyan:
+		return s.CMYK.C
+	case Magenta:
+		return s.CMYK.M
+	case Yellow:
+		return s.CMYK.Y
+	case Black:
+		return s.CMYK.K
+	}
+	return 0
+}
+
+// ProofRGB is the printed colour shown on screen, clipped to sRGB.
+func (s Separation) ProofRGB() colour.RGB {
+	return s.Proof.RGB()
+}
+
+// Plate draws a size by size square of ink printed on its own at the coverage of the separation, which is how
+// the plate for that ink would look if it were proofed alone.
+func (p Press) Plate(s Separation, ink Ink, size int) *image.NRGBA {
+	amount := s.Coverage(ink)
+	alone := map[Ink]colour.CMYK{Cyan: {C: amount}, Magenta: {M: amount}, Yellow: {Y: amount}, Black: {K: amount}}
+	c := p.Print(alone[ink]).RGB()
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255}), image.Point{}, draw.Src)
+	return img
+}
@@ -0,0 +1,220 @@
+// Package proof predicts how an sRGB colour prints on a four colour press, so customers can be warned before
+// ordering a colour that cannot be printed.
+//
+// The press is described by the measured colours of its paper, its inks and their overprints, and the colour of
+// any ink coverage is predicted with the Demichel-Neugebauer model. Predictions are relative colorimetric: the
+// paper is shown as white, as a customer looking at a print would see it.
+package proof
+
+import (
+	"math"
+
+	"github.com/projects/cmyk-api/handlers/colour"
+)
+
+// GamutTolerance is the CIEDE2000 difference above which a colour is reported as out of gamut. Differences below
+// it are hard to see side by side.
+const GamutTolerance = 2.0
+
+// Press describes a printing condition by the Lab colours of the paper and of solid ink coverage.
+type Press struct {
+	Paper colour.Lab
+	// Cyan, Magenta and Yellow are the solid inks and Red, Green, Blue and CMY their overprints, as in the
+	// characterisation data of the printing condition.
+	Cyan, Magenta, Yellow colour.Lab
+	Red, Green, Blue, CMY colour.Lab
+	Black                 colour.Lab
+	// TotalInkLimit is the largest sum of the four coverages the press can print, 3.0 for 300%.
+	TotalInkLimit float64
+}
+
+// Coated is offset printing on coated paper, using the ISO 12647-2 paper type 1 solids and overprints that FOGRA39
+// is based on.
+var Coated = Press{
+	Paper:         colour.Lab{L: 95, A: 0, B: -2},
+	Cyan:          colour.Lab{L: 55, A: -37, B: -50},
+	Magenta:       colour.Lab{L: 48, A: 74, B: -3},
+	Yellow:        colour.Lab{L: 89, A: -5, B: 93},
+	Red:           colour.Lab{L: 47, A: 68, B: 48},
+	Green:         colour.Lab{L: 50, A: -65, B: 27},
+	Blue:          colour.Lab{L: 24, A: 22, B: -46},
+	CMY:           colour.Lab{L: 23, A: 0, B: 0},
+	Black:         colour.Lab{L: 16, A: 0, B: 0},
+	TotalInkLimit: 3.0,
+}
+
+// Print predicts the colour of coverage c, relative to the paper.
+func (p Press) Print(c colour.CMYK) colour.Lab {
+	cy, m, y, k := clamp(c.C), clamp(c.M), clamp(c.Y), clamp(c.K)
+	primaries := []struct {
+		weight float64
+		colour colour.Lab
+	}{
+		{(1 - cy) * (1 - m) * (1 - y), p.Paper},
+		{cy * (1 - m) * (1 - y), p.Cyan},
+		{(1 - cy) * m * (1 - y), p.Magenta},
+		{(1 - cy) * (1 - m) * y, p.Yellow},
+		{(1 - cy) * m * y, p.Red},
+		{cy * (1 - m) * y, p.Green},
+		{cy * m * (1 - y), p.Blue},
+		{cy * m * y, p.CMY},
+	}
+
+	var printed colour.XYZ
+	for _, primary := range primaries {
+		xyz := primary.colour.XYZ()
+		printed.X += primary.weight * xyz.X
+		printed.Y += primary.weight * xyz.Y
+		printed.Z += primary.weight * xyz.Z
+	}
+
+	// black is printed last and darkens whatever is under it in proportion to how much light the solid passes
+	paper, black := p.Paper.XYZ(), p.Black.XYZ()
+	printed.X *= (1 - k) + k*black.X/paper.X
+	printed.Y *= (1 - k) + k*black.Y/paper.Y
+	printed.Z *= (1 - k) + k*black.Z/paper.Z
+
+	return colour.XYZ{
+		X: printed.X * colour.D65.X / paper.X,
+		Y: printed.Y * colour.D65.Y / paper.Y,
+		Z: printed.Z * colour.D65.Z / paper.Z,
+	}.Lab()
+}
+
+// Separation is the ink coverage chosen for a colour and what it will look like printed.
+type Separation struct {
+	Target colour.RGB
+	CMYK   colour.CMYK
+	// Proof is the printed colour, which is the closest printable colour to Target when Target is out of gamut.
+	Proof colour.Lab
+	// DeltaE is the CIEDE2000 difference between Target and Proof.
+	DeltaE float64
+}
+
+func (s Separation) InGamut() bool {
+	return s.DeltaE <= GamutTolerance
+}
+
+// Separate finds the coverage that prints closest to rgb.
+//
+// Black is generated from the naive conversion, 1 - max(r, g, b), so greys and shadows are carried by black ink
+// as presses prefer. Cyan, magenta and yellow are then solved for with damped Gauss-Newton steps on the Lab
+// difference, starting from the naive conversion and kept within the total ink limit.
+func (p Press) Separate(rgb colour.RGB) Separation {
+	target := rgb.Lab()
+	naive := rgb.CMYK()
+	x := [3]float64{naive.C, naive.M, naive.Y}
+	k := naive.K
+	x = p.limitInk(x, k)
+
+	residual := func(x [3]float64) [3]float64 {
+		printed := p.Print(colour.CMYK{C: x[0], M: x[1], Y: x[2], K: k})
+		return [3]float64{printed.L - target.L, printed.A - target.A, printed.B - target.B}
+	}
+	cost := func(r [3]float64) float64 { return r[0]*r[0] + r[1]*r[1] + r[2]*r[2] }
+
+	r := residual(x)
+	damping := 1e-3
+	for i := 0; i < 100 && cost(r) > 1e-8; i++ {
+		// the model is multilinear in each ink, so forward differences give an accurate Jacobian
+		var jacobian [3][3]float64
+		for ink := 0; ink < 3; ink++ {
+			const h = 1e-5
+			step := x
+			step[ink] += h
+			rh := residual(step)
+			for row := 0; row < 3; row++ {
+				jacobian[row][ink] = (rh[row] - r[row]) / h
+			}
+		}
+
+		var normal [3][3]float64
+		var gradient [3]float64
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				for row := 0; row < 3; row++ {
+					normal[a][b] += jacobian[row][a] * jacobian[row][b]
+				}
+			}
+			for row := 0; row < 3; row++ {
+				gradient[a] += jacobian[row][a] * r[row]
+			}
+		}
+
+		improved := false
+		for attempt := 0; attempt < 10; attempt++ {
+			damped := normal
+			for d := 0; d < 3; d++ {
+				damped[d][d] += damping * (normal[d][d] + 1e-9)
+			}
+			delta, ok := solve3(damped, gradient)
+			if !ok {
+				damping *= 10
+				continue
+			}
+			candidate := p.limitInk([3]float64{x[0] - delta[0], x[1] - delta[1], x[2] - delta[2]}, k)
+			if rc := residual(candidate); cost(rc) < cost(r) {
+				x, r = candidate, rc
+				damping = math.Max(damping/10, 1e-9)
+				improved = true
+				break
+			}
+			damping *= 10
+		}
+		if !improved {
+			break
+		}
+	}
+
+	cmyk := colour.CMYK{C: x[0], M: x[1], Y: x[2], K: k}
+	printed := p.Print(cmyk)
+	return Separation{Target: rgb, CMYK: cmyk, Proof: printed, DeltaE: colour.DeltaE2000(target, printed)}
+}
+
+// InGamut reports whether rgb can be printed within GamutTolerance.
+func (p Press) InGamut(rgb colour.RGB) bool {
+	return p.Separate(rgb).InGamut()
+}
+
+// limitInk keeps each coverage between 0 and 1 and reduces cyan, magenta and yellow together when the total would
+// go over the ink limit.
+func (p Press) limitInk(x [3]float64, k float64) [3]float64 {
+	for i := range x {
+		x[i] = clamp(x[i])
+	}
+	available := math.Max(0, p.TotalInkLimit-k)
+	if total := x[0] + x[1] + x[2]; total > available {
+		scale := available / total
+		for i := range x {
+			x[i] *= scale
+		}
+	}
+	return x
+}
+
+// solve3 solves a x = b by Cramer's rule.
+func solve3(a [3][3]float64, b [3]float64) ([3]float64, bool) {
+	det := func(m [3][3]float64) float64 {
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	d := det(a)
+	if math.Abs(d) < 1e-12 {
+		return [3]float64{}, false
+	}
+
+	var x [3]float64
+	for col := 0; col < 3; col++ {
+		m := a
+		for row := 0; row < 3; row++ {
+			m[row][col] = b[row]
+		}
+		x[col] = det(m) / d
+	}
+	return x, true
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
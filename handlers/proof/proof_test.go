@@ -0,0 +1,87 @@
+package proof
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/projects/cmyk-api/handlers/colour"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrint(t *testing.T) {
+	paper := Coated.Print(colour.CMYK{})
+	assert.InDelta(t, 100, paper.L, 1e-6, "the paper should proof as white")
+	assert.InDelta(t, 0, paper.A, 1e-6)
+	assert.InDelta(t, 0, paper.B, 1e-6)
+
+	black := Coated.Print(colour.CMYK{K: 1})
+	assert.InDelta(t, 17.4, black.L, 0.1, "solid black is the press black relative to the paper")
+
+	richBlack := Coated.Print(colour.CMYK{C: 0.6, M: 0.5, Y: 0.5, K: 1})
+	assert.Less(t, richBlack.L, black.L, "adding colour under black should darken it")
+}
+
+func TestSeparate(t *testing.T) {
+	tests := []struct {
+		rgb     colour.RGB
+		inGamut bool
+	}{
+		{colour.RGB{R: 255, G: 255, B: 255}, true},
+		{colour.RGB{R: 128, G: 128, B: 128}, true},
+		{colour.RGB{R: 0x99, G: 0x66, B: 0x55}, true},
+		{colour.RGB{R: 0xF0, G: 0xC8, B: 0x1E}, true},
+		{colour.RGB{R: 0x33, G: 0x66, B: 0x99}, true},
+		{colour.RGB{B: 255}, false},
+		{colour.RGB{G: 255}, false},
+		{colour.RGB{R: 0, G: 0xA0, B: 0xDC}, false},
+		{colour.RGB{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rgb.Hex(), func(t *testing.T) {
+			s := Coated.Separate(tt.rgb)
+			assert.Equal(t, tt.inGamut, s.InGamut(), "ΔE %.2f", s.DeltaE)
+			assert.Equal(t, tt.inGamut, Coated.InGamut(tt.rgb))
+
+			total := 0.0
+			for _, ink := range Inks {
+				assert.GreaterOrEqual(t, s.Coverage(ink), 0.0)
+				assert.LessOrEqual(t, s.Coverage(ink), 1.0)
+				total += s.Coverage(ink)
+			}
+			assert.LessOrEqual(t, total, Coated.TotalInkLimit+1e-9)
+
+			if tt.inGamut {
+				assert.InDelta(t, 0, colour.DeltaE2000(tt.rgb.Lab(), s.ProofRGB().Lab()), GamutTolerance+1, "the proof should look like the colour")
+			}
+		})
+	}
+}
+
+func TestSeparate_GreysUseBlack(t *testing.T) {
+	s := Coated.Separate(colour.RGB{R: 128, G: 128, B: 128})
+	assert.InDelta(t, 0.498, s.CMYK.K, 0.001)
+}
+
+func TestPlate(t *testing.T) {
+	s := Coated.Separate(colour.RGB{R: 0x33, G: 0x66, B: 0x99})
+
+	cyan := Coated.Plate(s, Cyan, 16)
+	require.Equal(t, image.Rect(0, 0, 16, 16), cyan.Bounds())
+	c := cyan.NRGBAAt(8, 8)
+	assert.Greater(t, c.B, c.R, "the cyan plate should be printed in cyan")
+
+	yellow := Coated.Plate(s, Yellow, 16)
+	assert.Equal(t, color.NRGBA{R: 255, G: 255, B: 255, A: 255}, yellow.NRGBAAt(0, 0), "there is no yellow in this blue")
+}
+
+func TestInkNames(t *testing.T) {
+	for _, ink := range Inks {
+		parsed, err := ParseInk(ink.String())
+		require.NoError(t, err)
+		assert.Equal(t, ink, parsed)
+	}
+	_, err := ParseInk("ORANGE")
+	assert.Error(t, err)
+}
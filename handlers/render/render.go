@@ -0,0 +1,224 @@
+// Package render draws product mockups by tinting a photographed template with the product colour.
+//
+// The bottle template is assets/bottleblank.png, a white bottle on a white background, and assets/bottlemask.png,
+// which is white over the liquid and the glass around it. The mask was made by flood filling the light grey
+// liquid of the blank below the cap and softening its edge by a pixel, so the label and the cap stay as
+// photographed.
+package render
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/projects/cmyk-api/handlers/colour"
+	"golang.org/x/image/draw"
+)
+
+var (
+	//go:embed assets/bottleblank.png
+	bottleBlank []byte
+	//go:embed assets/bottlemask.png
+	bottleMask []byte
+)
+
+// Size is the edge length in pixels of a square mockup. Sizes are even so the image can be converted to WebP,
+// which stores colour at half resolution, without padding.
+type Size int
+
+const (
+	Thumbnail Size = 128
+	Card      Size = 256
+	Full      Size = 496
+)
+
+var sizeNames = map[string]Size{"THUMBNAIL": Thumbnail, "CARD": Card, "FULL": Full}
+
+// ParseSize reads the PreviewSize names used in schema.api.graphql.
+func ParseSize(s string) (Size, error) {
+	size, ok := sizeNames[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown size [%s]", s)
+	}
+	return size, nil
+}
+
+func (s Size) String() string {
+	for name, size := range sizeNames {
+		if size == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("%dpx", int(s))
+}
+
+// Swatch is a disc of flat product colour drawn over the mockup, in the coordinates of the template.
+type Swatch struct {
+	Center image.Point
+	Radius int
+}
+
+// Template is a photographed product that can be tinted. Only the pixels under the mask are tinted, in proportion
+// to the mask's grey level.
+type Template struct {
+	base   *image.NRGBA
+	mask   *image.Gray
+	swatch Swatch
+	// level is the grey of the flat liquid in base, which is rendered as exactly the product colour.
+	level float64
+}
+
+// NewTemplate creates a Template from a base image and a mask of the same size. swatch may be the zero Swatch to
+// leave it out.
+func NewTemplate(base image.Image, mask image.Image, swatch Swatch) (*Template, error) {
+	if base.Bounds().Size() != mask.Bounds().Size() {
+		return nil, fmt.Errorf("mask is %v but the base image is %v", mask.Bounds().Size(), base.Bounds().Size())
+	}
+
+	t := &Template{
+		base:   image.NewNRGBA(image.Rect(0, 0, base.Bounds().Dx(), base.Bounds().Dy())),
+		mask:   image.NewGray(image.Rect(0, 0, mask.Bounds().Dx(), mask.Bounds().Dy())),
+		swatch: swatch,
+	}
+	draw.Draw(t.base, t.base.Bounds(), base, base.Bounds().Min, draw.Src)
+	draw.Draw(t.mask, t.mask.Bounds(), mask, mask.Bounds().Min, draw.Src)
+
+	level, ok := t.liquidLevel()
+	if !ok {
+		return nil, fmt.Errorf("mask does not cover a tintable area of the base image")
+	}
+	t.level = level
+	return t, nil
+}
+
+var (
+	bottleOnce     sync.Once
+	bottleTemplate *Template
+	bottleErr      error
+)
+
+// Bottle is the nail polish bottle template, with a swatch in the top left corner.
+func Bottle() (*Template, error) {
+	bottleOnce.Do(func() {
+		base, err := png.Decode(bytes.NewReader(bottleBlank))
+		if err != nil {
+			bottleErr = fmt.Errorf("decoding bottle template: %w", err)
+			return
+		}
+		mask, err := png.Decode(bytes.NewReader(bottleMask))
+		if err != nil {
+			bottleErr = fmt.Errorf("decoding bottle mask: %w", err)
+			return
+		}
+		bottleTemplate, bottleErr = NewTemplate(base, mask, Swatch{Center: image.Pt(50, 50), Radius: 50})
+	})
+	return bottleTemplate, bottleErr
+}
+
+// Render tints the template with c and scales it to size.
+//
+// The tint is a multiply blend normalised to the liquid, so the flat liquid comes out as c and shadows darken it
+// as they darkened the white liquid. Highlights brighter than the liquid are blended from c towards white rather
+// than multiplied, so the reflections on the glass survive dark colours.
+func (t *Template) Render(c colour.RGB, size Size) *image.NRGBA {
+	bounds := t.base.Bounds()
+	tinted := image.NewNRGBA(bounds)
+	tint := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := tinted.PixOffset(x, y)
+			src := t.base.Pix[i : i+4]
+			dst := tinted.Pix[i : i+4]
+			strength := float64(t.mask.GrayAt(x, y).Y) / 255
+			for ch := 0; ch < 3; ch++ {
+				dst[ch] = channel(float64(src[ch])*(1-strength) + t.tint(float64(src[ch]), tint[ch])*strength)
+			}
+			dst[3] = src[3]
+		}
+	}
+	t.drawSwatch(tinted, c)
+
+	if int(size) == bounds.Dx() && int(size) == bounds.Dy() {
+		return tinted
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, int(size), int(size)))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), tinted, bounds, draw.Src, nil)
+	return scaled
+}
+
+func (t *Template) tint(base float64, tint float64) float64 {
+	if base <= t.level {
+		return tint * base / t.level
+	}
+	return tint + (255-tint)*(base-t.level)/(255-t.level)
+}
+
+// drawSwatch fills the swatch disc with c, anti-aliasing its edge.
+func (t *Template) drawSwatch(img *image.NRGBA, c colour.RGB) {
+	if t.swatch.Radius <= 0 {
+		return
+	}
+	r := float64(t.swatch.Radius)
+	area := image.Rect(-t.swatch.Radius, -t.swatch.Radius, t.swatch.Radius, t.swatch.Radius).Add(t.swatch.Center).Intersect(img.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			dx := float64(x-t.swatch.Center.X) + 0.5
+			dy := float64(y-t.swatch.Center.Y) + 0.5
+			coverage := math.Max(0, math.Min(1, r-math.Hypot(dx, dy)+0.5))
+			if coverage == 0 {
+				continue
+			}
+			under := img.NRGBAAt(x, y)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: channel(float64(c.R)*coverage + float64(under.R)*(1-coverage)),
+				G: channel(float64(c.G)*coverage + float64(under.G)*(1-coverage)),
+				B: channel(float64(c.B)*coverage + float64(under.B)*(1-coverage)),
+				A: 255,
+			})
+		}
+	}
+}
+
+// liquidLevel finds the most common grey under the mask, which is the flat liquid rather than its edges.
+func (t *Template) liquidLevel() (float64, bool) {
+	var histogram [256]int
+	for y := 0; y < t.mask.Bounds().Dy(); y++ {
+		for x := 0; x < t.mask.Bounds().Dx(); x++ {
+			if t.mask.GrayAt(x, y).Y < 128 {
+				continue
+			}
+			grey := color.GrayModel.Convert(t.base.NRGBAAt(x, y)).(color.Gray)
+			histogram[grey.Y]++
+		}
+	}
+
+	level, count := 0, 0
+	for grey, n := range histogram {
+		if n > count {
+			level, count = grey, n
+		}
+	}
+	// a white liquid cannot be told apart from its highlights, and black cannot be tinted by multiplying
+	if count == 0 || level == 0 || level == 255 {
+		return 0, false
+	}
+	return float64(level), true
+}
+
+// EncodePNG writes img as a PNG, favouring size over speed since mockups are rendered once and served many times.
+func EncodePNG(w io.Writer, img image.Image) error {
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, img)
+}
+
+func channel(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/projects/cmyk-api/handlers/colour"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("thumbnail")
+	require.NoError(t, err)
+	assert.Equal(t, Thumbnail, size)
+	assert.Equal(t, "CARD", Card.String())
+
+	_, err = ParseSize("huge")
+	assert.Error(t, err)
+}
+
+func TestRenderBottle(t *testing.T) {
+	bottle, err := Bottle()
+	require.NoError(t, err)
+
+	red := colour.RGB{R: 200, G: 20, B: 40}
+	img := bottle.Render(red, Full)
+	require.Equal(t, image.Rect(0, 0, 496, 496), img.Bounds())
+
+	assert.Equal(t, color.NRGBA{R: 200, G: 20, B: 40, A: 255}, img.NRGBAAt(200, 230), "the flat liquid should be the product colour")
+	assert.Equal(t, color.NRGBA{R: 200, G: 20, B: 40, A: 255}, img.NRGBAAt(50, 50), "the swatch should be the product colour")
+	assert.Equal(t, bottle.base.NRGBAAt(248, 300), img.NRGBAAt(248, 300), "the label should not be tinted")
+	assert.Equal(t, bottle.base.NRGBAAt(248, 124), img.NRGBAAt(248, 124), "the cap should not be tinted")
+
+	shadow := img.NRGBAAt(200, 420)
+	assert.Less(t, shadow.R, red.R, "the shaded liquid at the bottom should be darker than the product colour")
+}
+
+// bottleblankout.png is the mockup the bottle template was designed from, with a grey swatch and an untinted
+// bottle. Rendering the same grey should reproduce it outside the liquid.
+func TestRenderBottleMatchesReference(t *testing.T) {
+	f, err := os.Open("testdata/bottleblankout.png")
+	require.NoError(t, err)
+	defer f.Close()
+	reference, err := png.Decode(f)
+	require.NoError(t, err)
+
+	bottle, err := Bottle()
+	require.NoError(t, err)
+	img := bottle.Render(colour.RGB{R: 85, G: 85, B: 85}, Full)
+
+	for _, p := range []image.Point{{50, 50}, {20, 50}, {400, 50}, {248, 124}, {248, 300}, {450, 450}} {
+		assert.Equal(t, color.NRGBAModel.Convert(reference.At(p.X, p.Y)), img.At(p.X, p.Y), "at %v", p)
+	}
+}
+
+func TestRenderScales(t *testing.T) {
+	bottle, err := Bottle()
+	require.NoError(t, err)
+
+	for _, size := range []Size{Thumbnail, Card} {
+		img := bottle.Render(colour.RGB{G: 128}, size)
+		assert.Equal(t, image.Rect(0, 0, int(size), int(size)), img.Bounds())
+
+		var buf bytes.Buffer
+		require.NoError(t, EncodePNG(&buf, img))
+		decoded, err := png.Decode(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, img.Bounds(), decoded.Bounds())
+	}
+}
+
+func TestNewTemplate_RejectsMismatchedMask(t *testing.T) {
+	_, err := NewTemplate(image.NewNRGBA(image.Rect(0, 0, 10, 10)), image.NewGray(image.Rect(0, 0, 5, 5)), Swatch{})
+	assert.Error(t, err)
+
+	_, err = NewTemplate(image.NewNRGBA(image.Rect(0, 0, 10, 10)), image.NewGray(image.Rect(0, 0, 10, 10)), Swatch{})
+	assert.Error(t, err, "an empty mask has nothing to tint")
+}
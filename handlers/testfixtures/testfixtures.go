@@ -0,0 +1,64 @@
+// Package testfixtures builds the in-memory repositories, products and AppSync events the resolver tests share.
+package testfixtures
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	ddb "github.com/projects/cmyk-api/handlers/db"
+	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/projects/cmyk-api/handlers/util"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// NewClock returns a clock fixed at the current time, so everything a test writes carries the same timestamps.
+func NewClock() util.Clock {
+	return util.NewFixedClock(time.Now())
+}
+
+// NewLogger logs everything, so a failing test shows what the handler did.
+func NewLogger() zerolog.Logger {
+	return util.NewDevLogger(zerolog.TraceLevel)
+}
+
+// NewProductsRepo returns an empty products table held in memory, with the colour bucket index searches use.
+func NewProductsRepo(clock util.Clock) *ddb.ProductsRepo {
+	return ddb.NewProductsRepo(ddb.NewInMemoryRepository(clock, "cmyk-products", ddb.ColourBucketIndex), clock)
+}
+
+// NewUsersRepo returns an empty users table held in memory.
+func NewUsersRepo(clock util.Clock) *ddb.UsersRepo {
+	return ddb.NewUsersRepo(ddb.NewInMemoryRepository(clock, "cmyk-users"), clock)
+}
+
+// NewProduct is a product of the colour rgb. Its description and price are not what any test is about.
+func NewProduct(rgb string) model.Product {
+	return model.Product{
+		Rgb:         rgb,
+		Description: "paint " + rgb,
+		Price:       model.Money{Price: model.MustParseDecimal("9.99"), CurrencyCode: model.GBP},
+	}
+}
+
+// AddProducts creates a product of each colour in repo, using the colour as its id so tests can refer to it.
+func AddProducts(t *testing.T, repo *ddb.ProductsRepo, rgbs ...string) []*model.Product {
+	products := make([]*model.Product, 0, len(rgbs))
+	for _, rgb := range rgbs {
+		product := NewProduct(rgb)
+		product.Id = rgb
+		created, err := repo.CreateProduct(context.TODO(), product)
+		require.NoError(t, err)
+		products = append(products, created)
+	}
+	return products
+}
+
+// Event unmarshals the resolver event AppSync would send as payload.
+func Event[E any](t *testing.T, payload string) E {
+	var event E
+	require.NoError(t, json.Unmarshal([]byte(payload), &event))
+	return event
+}
@@ -1,9 +1,26 @@
 package util
 
-import "time"
+import (
+	"sort"
+	"sync"
+	"time"
+)
 
+// Clock is the source of time for handlers and repositories, so tests can control expiry and waiting.
 type Clock interface {
 	Now() time.Time
+	// After sends the time on the returned channel once d has passed.
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	Sleep(d time.Duration)
+}
+
+// Timer is a time.Timer created by a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop and Reset report whether the timer was active, as time.Timer's do.
+	Stop() bool
+	Reset(d time.Duration) bool
 }
 
 func NewRealClock() RealClock {
@@ -12,8 +29,22 @@ func NewRealClock() RealClock {
 
 type RealClock struct{}
 
-func (f RealClock) Now() time.Time { return time.Now() }
+func (f RealClock) Now() time.Time                         { return time.Now() }
+func (f RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (f RealClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (f RealClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+type realTimer struct {
+	timer *time.Timer
+}
 
+func (t realTimer) C() <-chan time.Time        { return t.timer.C }
+func (t realTimer) Stop() bool                 { return t.timer.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.timer.Reset(d) }
+
+// FixedClock is frozen at one instant. Waiting on it costs nothing: timers fire straight away, at the frozen time,
+// so code that retries or sleeps runs without delay in tests that do not care about timing. Use FakeClock to
+// control when time passes.
 type FixedClock struct {
 	time time.Time
 }
@@ -24,3 +55,153 @@ func NewFixedClock(time time.Time) FixedClock {
 	}
 }
 func (f FixedClock) Now() time.Time { return f.time }
+
+func (f FixedClock) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C() }
+func (f FixedClock) NewTimer(d time.Duration) Timer {
+	t := &fixedTimer{at: f.time, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+func (f FixedClock) Sleep(d time.Duration) {}
+
+type fixedTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (t *fixedTimer) C() <-chan time.Time { return t.c }
+func (t *fixedTimer) Stop() bool          { return false }
+func (t *fixedTimer) Reset(d time.Duration) bool {
+	select {
+	case t.c <- t.at:
+	default:
+	}
+	return false
+}
+
+// FakeClock only moves when Advance or Set is called, firing the timers whose deadline has been reached in deadline
+// order. It is safe for concurrent use, so a test can advance it while the code under test sleeps in another
+// goroutine; WaitForTimers lets the test wait until that goroutine is sleeping.
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d and fires the timers that are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to now, which may be in the past, and fires the timers that are due.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(now)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schedule(t, d)
+	return t
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// WaitForTimers blocks until at least n timers are waiting to fire.
+func (c *FakeClock) WaitForTimers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// set and the other lower case methods expect the lock to be held.
+func (c *FakeClock) set(now time.Time) {
+	c.now = now
+
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].deadline.Before(c.timers[j].deadline) })
+	due := 0
+	for due < len(c.timers) && !c.timers[due].deadline.After(now) {
+		c.timers[due].fire(now)
+		due++
+	}
+	c.timers = c.timers[due:]
+	c.changed.Broadcast()
+}
+
+func (c *FakeClock) schedule(t *fakeTimer, d time.Duration) {
+	t.deadline = c.now.Add(d)
+	if d <= 0 {
+		t.fire(c.now)
+		return
+	}
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+}
+
+func (c *FakeClock) unschedule(t *fakeTimer) bool {
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.unschedule(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.unschedule(t)
+	t.clock.schedule(t, d)
+	return active
+}
+
+// fire does not block. As with time.Timer, a value that has not been received is kept and the new one dropped.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
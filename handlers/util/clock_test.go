@@ -0,0 +1,109 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock_Advance(t *testing.T) {
+
+	start := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	late := clock.After(2 * time.Hour)
+	early := clock.NewTimer(time.Hour)
+
+	clock.Advance(59 * time.Minute)
+	assert.Equal(t, start.Add(59*time.Minute), clock.Now())
+	assertNotFired(t, early.C())
+	assertNotFired(t, late)
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Hour), <-early.C())
+	assertNotFired(t, late)
+
+	clock.Advance(3 * time.Hour)
+	assert.Equal(t, start.Add(4*time.Hour), <-late, "a timer fires at the time the clock was advanced to")
+}
+
+func TestFakeClock_Set(t *testing.T) {
+
+	start := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.After(time.Hour)
+
+	clock.Set(start.Add(-time.Hour))
+	assert.Equal(t, start.Add(-time.Hour), clock.Now())
+	assertNotFired(t, timer)
+
+	clock.Set(start.Add(time.Hour))
+	assert.Equal(t, start.Add(time.Hour), <-timer)
+}
+
+func TestFakeClock_StopAndReset(t *testing.T) {
+
+	clock := NewFakeClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	timer := clock.NewTimer(time.Minute)
+
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop(), "a stopped timer is no longer active")
+	clock.Advance(time.Hour)
+	assertNotFired(t, timer.C())
+
+	assert.False(t, timer.Reset(time.Minute))
+	assert.True(t, timer.Reset(2*time.Minute), "resetting an active timer moves its deadline")
+	clock.Advance(time.Minute)
+	assertNotFired(t, timer.C())
+	clock.Advance(time.Minute)
+	<-timer.C()
+
+	<-clock.After(0)
+}
+
+func TestFakeClock_Sleep(t *testing.T) {
+
+	start := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	woke := make(chan time.Time)
+	go func() {
+		clock.Sleep(time.Second)
+		woke <- clock.Now()
+	}()
+
+	clock.WaitForTimers(1)
+	select {
+	case <-woke:
+		require.Fail(t, "woke before the clock was advanced")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-woke)
+}
+
+func TestFixedClock_TimersFireImmediately(t *testing.T) {
+
+	fixed := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFixedClock(fixed)
+
+	assert.Equal(t, fixed, <-clock.After(time.Hour))
+	clock.Sleep(time.Hour)
+
+	timer := clock.NewTimer(time.Hour)
+	assert.Equal(t, fixed, <-timer.C())
+	timer.Reset(time.Hour)
+	assert.Equal(t, fixed, <-timer.C())
+	assert.Equal(t, fixed, clock.Now())
+}
+
+func assertNotFired(t *testing.T, c <-chan time.Time) {
+	select {
+	case fired := <-c:
+		assert.Fail(t, "timer fired early", "fired at %v", fired)
+	default:
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/brianvoe/gofakeit"
 	"github.com/projects/cmyk-api/handlers/model"
 	"github.com/stretchr/testify/require"
+	"net/url"
 	"os"
 	"testing"
 	"time"
@@ -44,6 +45,45 @@ func WithCreatedAt(createdAt time.Time) TestUserOptions {
 	}
 }
 
+func WithEmail(email string) TestUserOptions {
+	return func(user model.User) model.User {
+		user.Email = email
+		return user
+	}
+}
+
+// TestDataLifespan is how long test users live, Short unless model.LifespanEnvKey is set, e.g. to keep fixtures
+// longer in staging. None is refused unless DYNAMO_ENDPOINT points at a local DynamoDB, so a test run cannot
+// leave data in a shared table for good.
+func TestDataLifespan(t *testing.T) model.Lifespan {
+	lifespan, err := testDataLifespan(os.Getenv("DYNAMO_ENDPOINT"))
+	require.NoError(t, err)
+	return lifespan
+}
+
+func testDataLifespan(endpoint string) (model.Lifespan, error) {
+	lifespan, err := model.LifespanFromEnv(model.LifespanEnvKey, model.Short)
+	if err != nil {
+		return 0, err
+	}
+	if lifespan == model.None && !isLocalEndpoint(endpoint) {
+		return 0, fmt.Errorf("%s=none keeps test data for good so is only allowed against a local DynamoDB, not [%s]", model.LifespanEnvKey, endpoint)
+	}
+	return lifespan, nil
+}
+
+func isLocalEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
 func GetOSEnvOrFail(t *testing.T, key string) string {
 	value := os.Getenv(key)
 	require.NotEmpty(t, value, fmt.Sprintf("environment variable with key [%s] must not be empty", key))
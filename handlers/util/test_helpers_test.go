@@ -2,6 +2,8 @@ package util
 
 import (
 	"github.com/projects/cmyk-api/handlers/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
 )
@@ -28,7 +30,28 @@ func Test_TestLifespan(t *testing.T) {
 			},
 			want: fixedDate.Add(oneDay).Unix(),
 		}, {
-			name: "When no Lifespans is given return Short",
+			name: "Long Lifespans should return 30 days in the future",
+			args: args{
+				lifespan: model.Long,
+				clock:    NewFixedClock(fixedDate),
+			},
+			want: fixedDate.Add(30 * oneDay).Unix(),
+		}, {
+			name: "Custom Lifespans should return their duration in the future",
+			args: args{
+				lifespan: model.Custom(90 * time.Minute),
+				clock:    NewFixedClock(fixedDate),
+			},
+			want: fixedDate.Add(90 * time.Minute).Unix(),
+		}, {
+			name: "None should disable the TTL",
+			args: args{
+				lifespan: model.None,
+				clock:    NewFixedClock(fixedDate),
+			},
+			want: 0,
+		}, {
+			name: "When an invalid Lifespan is given return Short",
 			args: args{
 				lifespan: -1,
 				clock:    NewFixedClock(fixedDate),
@@ -44,3 +67,22 @@ func Test_TestLifespan(t *testing.T) {
 		})
 	}
 }
+
+func Test_TestDataLifespan_NoneOnlyLocally(t *testing.T) {
+
+	t.Setenv(model.LifespanEnvKey, "none")
+	for _, endpoint := range []string{"http://localhost:8000", "http://127.0.0.1:8000"} {
+		lifespan, err := testDataLifespan(endpoint)
+		require.NoError(t, err, endpoint)
+		assert.Equal(t, model.None, lifespan)
+	}
+	for _, endpoint := range []string{"", "https://dynamodb.eu-west-2.amazonaws.com"} {
+		_, err := testDataLifespan(endpoint)
+		assert.Error(t, err, "none must be refused against [%s]", endpoint)
+	}
+
+	t.Setenv(model.LifespanEnvKey, "long")
+	lifespan, err := testDataLifespan("")
+	require.NoError(t, err)
+	assert.Equal(t, model.Long, lifespan)
+}
@@ -1,15 +1,88 @@
 package util
 
 import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+
 	"github.com/oklog/ulid/v2"
-	"math/rand"
-	"time"
 )
 
-func CurrentTimeAndULID(clock Clock) (time.Time, ulid.ULID, error) {
-	currentTime := clock.Now()
-	entropy := rand.New(rand.NewSource(currentTime.UnixNano()))
-	ms := ulid.Timestamp(currentTime)
-	id, err := ulid.New(ms, entropy)
-	return currentTime, id, err
+// IDPrefix names the type of entity an ID belongs to, so IDs of different types cannot be confused.
+type IDPrefix string
+
+const (
+	ProductIDPrefix IDPrefix = "prod"
+	OrderIDPrefix   IDPrefix = "ord"
+)
+
+// IDGenerator creates ULIDs that sort in the order they were generated.
+type IDGenerator interface {
+	NewULID() (ulid.ULID, error)
+	// NewID returns a ULID with a type prefix, such as prod_01ARZ3NDEKTSV4RRFFQ69G5FAV.
+	NewID(prefix IDPrefix) (string, error)
+}
+
+// MonotonicIDGenerator is safe for concurrent use. IDs within the same millisecond increment the previous one's
+// entropy, and if the clock goes backwards the millisecond of the last ID is reused, so each ID is greater than
+// the last.
+type MonotonicIDGenerator struct {
+	clock   Clock
+	mu      sync.Mutex
+	entropy *ulid.MonotonicEntropy
+	last    uint64
+}
+
+// NewIDGenerator creates a MonotonicIDGenerator with entropy from crypto/rand.
+func NewIDGenerator(clock Clock) *MonotonicIDGenerator {
+	return newMonotonicIDGenerator(clock, rand.Reader)
+}
+
+// NewSeededIDGenerator creates a MonotonicIDGenerator whose IDs are repeatable for the same seed and clock, for
+// tests.
+func NewSeededIDGenerator(clock Clock, seed int64) *MonotonicIDGenerator {
+	return newMonotonicIDGenerator(clock, mathrand.New(mathrand.NewSource(seed)))
+}
+
+func newMonotonicIDGenerator(clock Clock, entropy io.Reader) *MonotonicIDGenerator {
+	return &MonotonicIDGenerator{
+		clock:   clock,
+		entropy: ulid.Monotonic(entropy, 0),
+	}
+}
+
+func (g *MonotonicIDGenerator) NewULID() (ulid.ULID, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := ulid.Timestamp(g.clock.Now())
+	if ms < g.last {
+		ms = g.last
+	}
+	id, err := ulid.New(ms, g.entropy)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	g.last = ms
+	return id, nil
+}
+
+func (g *MonotonicIDGenerator) NewID(prefix IDPrefix) (string, error) {
+	id, err := g.NewULID()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%s", prefix, id), nil
+}
+
+// ParseID returns the ULID of an ID created by NewID with prefix.
+func ParseID(prefix IDPrefix, id string) (ulid.ULID, error) {
+	value, ok := strings.CutPrefix(id, string(prefix)+"_")
+	if !ok {
+		return ulid.ULID{}, fmt.Errorf("id [%s] does not start with [%s_]", id, prefix)
+	}
+	return ulid.ParseStrict(value)
 }
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonotonicIDGenerator_IncreasesWithinAMillisecond(t *testing.T) {
+
+	ids := NewIDGenerator(NewFixedClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	generated := make([][]ulid.ULID, 8)
+	var wg sync.WaitGroup
+	for worker := range generated {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				id, err := ids.NewULID()
+				require.NoError(t, err)
+				generated[worker] = append(generated[worker], id)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	seen := map[ulid.ULID]bool{}
+	for _, worker := range generated {
+		assert.True(t, sort.SliceIsSorted(worker, func(i, j int) bool { return worker[i].Compare(worker[j]) < 0 }))
+		for _, id := range worker {
+			assert.False(t, seen[id], "duplicate id %s", id)
+			seen[id] = true
+		}
+	}
+}
+
+func TestMonotonicIDGenerator_ClockGoesBackwards(t *testing.T) {
+
+	start := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ids := NewIDGenerator(clock)
+
+	first, err := ids.NewULID()
+	require.NoError(t, err)
+	clock.Set(start.Add(-time.Second))
+	second, err := ids.NewULID()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, second.Compare(first))
+	assert.Equal(t, ulid.Timestamp(start), second.Time())
+}
+
+func TestSeededIDGenerator_IsRepeatable(t *testing.T) {
+
+	clock := NewFixedClock(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC))
+	first, second := NewSeededIDGenerator(clock, 42), NewSeededIDGenerator(clock, 42)
+
+	for i := 0; i < 3; i++ {
+		a, err := first.NewID(ProductIDPrefix)
+		require.NoError(t, err)
+		b, err := second.NewID(ProductIDPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, a, b)
+	}
+
+	a, err := NewSeededIDGenerator(clock, 42).NewID(ProductIDPrefix)
+	require.NoError(t, err)
+	b, err := NewSeededIDGenerator(clock, 7).NewID(ProductIDPrefix)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestNewIDAndParseID(t *testing.T) {
+
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	ids := NewIDGenerator(NewFixedClock(now))
+
+	id, err := ids.NewID(OrderIDPrefix)
+	require.NoError(t, err)
+	assert.Regexp(t, `^ord_[0-9A-HJKMNP-TV-Z]{26}$`, id)
+
+	parsed, err := ParseID(OrderIDPrefix, id)
+	require.NoError(t, err)
+	assert.Equal(t, ulid.Timestamp(now), parsed.Time())
+
+	_, err = ParseID(ProductIDPrefix, id)
+	assert.Error(t, err, "an order id is not a product id")
+	_, err = ParseID(OrderIDPrefix, "ord_not-a-ulid")
+	assert.Error(t, err)
+}